@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"sync"
+	"time"
 
 	"k8s.io/klog"
 
@@ -12,37 +14,59 @@ import (
 
 	"github.com/openshift/cluster-resource-override-admission/pkg/api"
 	"github.com/openshift/cluster-resource-override-admission/pkg/clusterresourceoverride"
+	"github.com/openshift/cluster-resource-override-admission/pkg/decisionlog"
+	"github.com/openshift/cluster-resource-override-admission/pkg/metrics"
 	admissionresponse "github.com/openshift/cluster-resource-override-admission/pkg/response"
+	"github.com/openshift/cluster-resource-override-admission/pkg/tracing"
 )
 
 type clusterResourceOverrideHook struct {
 	lock        sync.RWMutex
 	initialized bool
 
-	admission clusterresourceoverride.Admission
+	admission   clusterresourceoverride.Admission
+	decisionLog *decisionlog.Logger
 }
 
 // Initialize is called as a post-start hook
 func (m *clusterResourceOverrideHook) Initialize(kubeClientConfig *restclient.Config, stopCh <-chan struct{}) error {
 	klog.V(1).Infof("name=%s initializing admission webhook", clusterresourceoverride.Name)
 
-	m.lock.Lock()
-	defer func() {
-		m.initialized = true
-		m.lock.Unlock()
-	}()
+	m.lock.RLock()
+	initialized := m.initialized
+	m.lock.RUnlock()
 
-	if m.initialized {
+	if initialized {
 		return nil
 	}
 
+	metrics.Register()
+
+	if err := tracing.Setup(stopCh); err != nil {
+		klog.V(1).Infof("name=%s failed to set up tracing - %s", clusterresourceoverride.Name, err.Error())
+		return err
+	}
+
+	decisionLog, err := decisionlog.NewFromEnv(stopCh)
+	if err != nil {
+		klog.V(1).Infof("name=%s failed to set up decision log - %s", clusterresourceoverride.Name, err.Error())
+		return err
+	}
+
+	// Loading the configuration and starting the informers must not block
+	// health checks, so the lock is only taken once the admission is ready to use.
 	admission, err := clusterresourceoverride.NewInClusterAdmission(kubeClientConfig, stopCh)
 	if err != nil {
 		klog.V(1).Infof("name=%s failed to initialize webhook - %s", clusterresourceoverride.Name, err.Error())
 		return err
 	}
 
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
 	m.admission = admission
+	m.decisionLog = decisionLog
+	m.initialized = true
 
 	klog.V(1).Infof("name=%s admission webhook loaded successfully", clusterresourceoverride.Name)
 	klog.V(1).Infof("name=%s configuration=%s", clusterresourceoverride.Name, admission.GetConfiguration())
@@ -50,6 +74,40 @@ func (m *clusterResourceOverrideHook) Initialize(kubeClientConfig *restclient.Co
 	return nil
 }
 
+// Ready returns an error until the configuration has been loaded and the
+// informers the webhook relies on have synced.
+func (m *clusterResourceOverrideHook) Ready() error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if !m.initialized {
+		return errors.New("not initialized")
+	}
+
+	if m.admission.GetConfiguration() == nil {
+		return errors.New("configuration not loaded")
+	}
+
+	if !m.admission.HasSynced() {
+		return errors.New("informers have not synced")
+	}
+
+	return nil
+}
+
+// Alive returns an error if the informers the webhook relies on have gone
+// stale. The webhook is considered alive while it is initializing.
+func (m *clusterResourceOverrideHook) Alive() error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if !m.initialized {
+		return nil
+	}
+
+	return m.admission.CheckStaleness()
+}
+
 // MutatingResource is the resource to use for hosting your admission webhook. If the hook implements
 // ValidatingAdmissionHook as well, the two resources for validating and mutating admission must be different.
 // Note: this is (usually) not the same as the payload resource!
@@ -67,23 +125,70 @@ func (m *clusterResourceOverrideHook) Admit(request *admissionv1.AdmissionReques
 	m.lock.RLock()
 	defer m.lock.RUnlock()
 
+	// The admission server does not hand the HTTP request context to the hook,
+	// spans are correlated with those of the API server by the request UID.
+	ctx, span := tracing.Start(context.Background(), "Admit",
+		tracing.NamespaceKey.String(request.Namespace), tracing.RequestUIDKey.String(string(request.UID)))
+
+	decision := clusterresourceoverride.NewDecision(request)
+	ctx = clusterresourceoverride.WithDecision(ctx, decision)
+
+	start := time.Now()
+	outcome := metrics.OutcomeError
+	defer func() {
+		elapsed := time.Since(start)
+		metrics.ObserveAdmitLatency(outcome, elapsed)
+		span.SetAttributes(tracing.OutcomeKey.String(outcome))
+		span.End()
+
+		decision.Outcome = outcome
+		decision.LatencyMillis = float64(elapsed.Microseconds()) / 1000
+		m.decisionLog.Write(decision)
+	}()
+
 	if !m.initialized {
+		metrics.RecordRequest(request.Namespace, metrics.OutcomeError, metrics.ReasonNotInitialized)
+		decision.Reason = metrics.ReasonNotInitialized
 		return admissionresponse.WithInternalServerError(request, errors.New("not initialized"))
 	}
 
 	if !m.admission.IsApplicable(request) {
+		outcome = metrics.OutcomeNotApplicable
+		metrics.RecordRequest(request.Namespace, outcome, "")
 		return admissionresponse.WithAllowed(request)
 	}
 
-	exempt, selinuxExempt, response := m.admission.IsExempt(request)
+	decision.Applicable = true
+
+	exempt, selinuxExempt, response := m.admission.IsExempt(ctx, request)
 	if response != nil {
+		if decision.FailedOpen {
+			outcome = metrics.OutcomeFailedOpen
+		}
 		return response
 	}
 
+	decision.Exempt, decision.SelinuxExempt = exempt, selinuxExempt
+
 	if exempt && selinuxExempt {
 		// disabled for this project, do nothing
-		return admissionresponse.WithAllowed(request)
+		outcome = metrics.OutcomeExempt
+		metrics.RecordRequest(request.Namespace, outcome, "")
+		return admissionresponse.WithAuditAnnotation(admissionresponse.WithAllowed(request),
+			clusterresourceoverride.AuditExemptReasonKey, clusterresourceoverride.ExemptReasonNamespaceNotEnabled)
+	}
+
+	response = m.admission.Admit(ctx, request)
+	switch {
+	case decision.FailedOpen:
+		outcome = metrics.OutcomeFailedOpen
+	case decision.Rejected:
+		outcome = metrics.OutcomeRejected
+	case decision.Unchanged:
+		outcome = metrics.OutcomeUnchanged
+	case response.Allowed:
+		outcome = metrics.OutcomeMutated
 	}
 
-	return m.admission.Admit(request)
+	return response
 }
@@ -1,9 +1,20 @@
 package main
 
 import (
-	"github.com/openshift/generic-admission-server/pkg/cmd"
+	"os"
+	"runtime"
+
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/component-base/cli"
 )
 
 func main() {
-	cmd.RunAdmissionServer(&clusterResourceOverrideHook{})
+	if len(os.Getenv("GOMAXPROCS")) == 0 {
+		runtime.GOMAXPROCS(runtime.NumCPU())
+	}
+
+	stopCh := genericapiserver.SetupSignalHandler()
+
+	code := cli.Run(newCommandStartAdmissionServer(os.Stdout, os.Stderr, stopCh, &clusterResourceOverrideHook{}))
+	os.Exit(code)
 }
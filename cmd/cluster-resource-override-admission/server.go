@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apiserver/pkg/server/healthz"
+
+	"github.com/openshift/generic-admission-server/pkg/cmd/server"
+)
+
+// newCommandStartAdmissionServer mirrors the command of the generic admission
+// server and registers the readiness and liveness checks of the webhook.
+func newCommandStartAdmissionServer(out, errOut io.Writer, stopCh <-chan struct{}, hook *clusterResourceOverrideHook) *cobra.Command {
+	o := server.NewAdmissionServerOptions(out, errOut, hook)
+
+	cmd := &cobra.Command{
+		Short: "Launch the cluster resource override admission webhook",
+		Long:  "Launch the cluster resource override admission webhook",
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(); err != nil {
+				return err
+			}
+			if err := o.Validate(args); err != nil {
+				return err
+			}
+
+			config, err := o.Config()
+			if err != nil {
+				return err
+			}
+
+			config.GenericConfig.AddReadyzChecks(healthz.NamedCheck("clusterresourceoverride-ready", func(_ *http.Request) error {
+				return hook.Ready()
+			}))
+			config.GenericConfig.AddLivezChecks(healthz.NamedCheck("clusterresourceoverride-informers", func(_ *http.Request) error {
+				return hook.Alive()
+			}))
+
+			server, err := config.Complete().New()
+			if err != nil {
+				return err
+			}
+			return server.GenericAPIServer.PrepareRun().Run(stopCh)
+		},
+	}
+
+	o.AddFlags(cmd.Flags())
+
+	return cmd
+}
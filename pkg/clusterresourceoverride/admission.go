@@ -1,6 +1,7 @@
 package clusterresourceoverride
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,15 +12,24 @@ import (
 	"k8s.io/client-go/tools/cache"
 
 	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	corev1listers "k8s.io/client-go/listers/core/v1"
 	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog"
 
 	"github.com/openshift/cluster-resource-override-admission/pkg/api"
+	"github.com/openshift/cluster-resource-override-admission/pkg/metrics"
 	admissionresponse "github.com/openshift/cluster-resource-override-admission/pkg/response"
+	"github.com/openshift/cluster-resource-override-admission/pkg/tracing"
 )
 
 const (
@@ -62,12 +72,19 @@ type Admission interface {
 	// Otherwise it returns false. On any error, response is set with appropriate
 	// status and error message.
 	// If response is not nil, the caller should not proceed with the admission.
-	IsExempt(request *admissionv1.AdmissionRequest) (exempt bool, selinuxExempt bool, response *admissionv1.AdmissionResponse)
+	IsExempt(ctx context.Context, request *admissionv1.AdmissionRequest) (exempt bool, selinuxExempt bool, response *admissionv1.AdmissionResponse)
 
 	// Admit makes an attempt to admit the specified resource in the request.
 	// It returns an AdmissionResponse that is set appropriately. On success,
 	// the response should contain the patch for update.
-	Admit(admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse
+	Admit(ctx context.Context, admissionSpec *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse
+
+	// HasSynced returns true once the caches the admission logic relies on have synced.
+	HasSynced() bool
+
+	// CheckStaleness returns an error if the caches the admission logic relies
+	// on have not received any event for too long.
+	CheckStaleness() error
 }
 
 // NewInClusterAdmission returns a new instance of Admission that is appropriate
@@ -102,40 +119,241 @@ func NewAdmission(kubeClientConfig *restclient.Config, stopCh <-chan struct{}, c
 		return
 	}
 
+	// configurations accepted before they were validated keep working, the
+	// top-level percents out of range are applied as they were.
+	if ratiosErr := utilerrors.NewAggregate(config.validateRatios("")); ratiosErr != nil {
+		klog.Warningf("name=%s invalid configuration - %s", Name, ratiosErr.Error())
+	}
+
+	// the other settings were introduced with their validation, and can't be
+	// applied if invalid.
+	if settingsErr := utilerrors.NewAggregate(config.validateSettings()); settingsErr != nil {
+		err = fmt.Errorf("name=%s invalid configuration - %s", Name, settingsErr.Error())
+		return
+	}
+
+	resyncPeriod, envErr := durationFromEnv(resyncPeriodEnvName, defaultResyncPeriod)
+	if envErr != nil {
+		err = fmt.Errorf("name=%s %s", Name, envErr.Error())
+		return
+	}
+
+	// Informers are sent bookmarks far more often than they resync, which
+	// bounds the default from above.
+	stalenessThreshold, envErr := durationFromEnv(stalenessThresholdEnvName, 2*resyncPeriod)
+	if envErr != nil {
+		err = fmt.Errorf("name=%s %s", Name, envErr.Error())
+		return
+	}
+
+	nsLabelSelectors, envErr := namespaceLabelSelectors()
+	if envErr != nil {
+		err = fmt.Errorf("name=%s %s", Name, envErr.Error())
+		return
+	}
+
 	client, clientErr := kubernetes.NewForConfig(kubeClientConfig)
 	if clientErr != nil {
 		err = fmt.Errorf("name=%s failed to load configuration - %s", Name, clientErr.Error())
 		return
 	}
 
-	factory := informers.NewSharedInformerFactory(client, defaultResyncPeriod)
+	factory := informers.NewSharedInformerFactoryWithOptions(client, resyncPeriod, informers.WithTransform(stripManagedFields))
+
+	activity := newInformerActivity(stalenessThreshold)
 
-	namespaces := factory.Core().V1().Namespaces()
-	nsInformer := namespaces.Informer()
-	go nsInformer.Run(stopCh)
+	var nsInformers []cache.SharedIndexInformer
+	var nsListers namespaceListers
+	for _, selector := range nsLabelSelectors {
+		nsInformer, informerErr := newNamespaceMetadataInformer(kubeClientConfig, resyncPeriod, selector)
+		if informerErr != nil {
+			err = fmt.Errorf("name=%s failed to create Namespace informer - %s", Name, informerErr.Error())
+			return
+		}
+
+		name := "namespaces"
+		if selector != "" {
+			name = fmt.Sprintf("namespaces{%s}", selector)
+		}
+		if trackErr := activity.track(name, nsInformer); trackErr != nil {
+			err = fmt.Errorf("name=%s failed to track Namespace informer - %s", Name, trackErr.Error())
+			return
+		}
+
+		nsInformers = append(nsInformers, nsInformer)
+		nsListers = append(nsListers, corev1listers.NewNamespaceLister(nsInformer.GetIndexer()))
+	}
 
 	limitRanges := factory.Core().V1().LimitRanges()
 	limitRangeInformer := limitRanges.Informer()
-	go limitRangeInformer.Run(stopCh)
+	if trackErr := activity.track("limitranges", limitRangeInformer); trackErr != nil {
+		err = fmt.Errorf("name=%s failed to track LimitRange informer - %s", Name, trackErr.Error())
+		return
+	}
 
-	if !cache.WaitForCacheSync(stopCh, nsInformer.HasSynced) {
-		err = fmt.Errorf("name=%s failed to wait for Namespace informer cache to sync", Name)
+	runtimeClasses := factory.Node().V1().RuntimeClasses()
+	runtimeClassInformer := runtimeClasses.Informer()
+	if trackErr := activity.track("runtimeclasses", runtimeClassInformer); trackErr != nil {
+		err = fmt.Errorf("name=%s failed to track RuntimeClass informer - %s", Name, trackErr.Error())
+		return
+	}
+
+	nsGetter := newNamespaceGetter(nsListers, client)
+	limitRangeLister := newLimitRangeLister(limitRanges.Lister(), nsGetter, client)
+	for _, nsInformer := range nsInformers {
+		if _, handlerErr := nsInformer.AddEventHandler(forgetOnAdd(nsGetter.forget, metav1.Object.GetName)); handlerErr != nil {
+			err = fmt.Errorf("name=%s failed to add Namespace event handler - %s", Name, handlerErr.Error())
+			return
+		}
+	}
+	if _, handlerErr := limitRangeInformer.AddEventHandler(forgetOnAdd(limitRangeLister.forget, metav1.Object.GetNamespace)); handlerErr != nil {
+		err = fmt.Errorf("name=%s failed to add LimitRange event handler - %s", Name, handlerErr.Error())
 		return
 	}
+	bounds := newBoundsCache()
+	if _, handlerErr := limitRangeInformer.AddEventHandler(bounds.handler()); handlerErr != nil {
+		err = fmt.Errorf("name=%s failed to add LimitRange event handler - %s", Name, handlerErr.Error())
+		return
+	}
+
+	// ResourceQuotas are only watched if the configuration checks them.
+	var quotas []QuotaSource
+	if config.QuotaAction != "" {
+		resourceQuotas := factory.Core().V1().ResourceQuotas()
+		resourceQuotaInformer := resourceQuotas.Informer()
+		if trackErr := activity.track("resourcequotas", resourceQuotaInformer); trackErr != nil {
+			err = fmt.Errorf("name=%s failed to track ResourceQuota informer - %s", Name, trackErr.Error())
+			return
+		}
+
+		go resourceQuotaInformer.Run(stopCh)
+		if !cache.WaitForCacheSync(stopCh, resourceQuotaInformer.HasSynced) {
+			err = fmt.Errorf("name=%s failed to wait for ResourceQuota informer cache to sync", Name)
+			return
+		}
+
+		quotas = append(quotas, newResourceQuotaSource(resourceQuotas.Lister()))
+	}
+
+	// Nodes are only watched if the configuration caps to their allocatable.
+	var nodes *nodeCapacity
+	if config.CapToNodeAllocatable {
+		nodeInformer := factory.Core().V1().Nodes().Informer()
+		if transformErr := nodeInformer.SetTransform(slimNode); transformErr != nil {
+			err = fmt.Errorf("name=%s failed to set Node transform - %s", Name, transformErr.Error())
+			return
+		}
+		if trackErr := activity.track("nodes", nodeInformer); trackErr != nil {
+			err = fmt.Errorf("name=%s failed to track Node informer - %s", Name, trackErr.Error())
+			return
+		}
+
+		go nodeInformer.Run(stopCh)
+		if !cache.WaitForCacheSync(stopCh, nodeInformer.HasSynced) {
+			err = fmt.Errorf("name=%s failed to wait for Node informer cache to sync", Name)
+			return
+		}
+
+		nodes = newNodeCapacity(corev1listers.NewNodeLister(nodeInformer.GetIndexer()))
+	}
+
+	// PriorityClasses are only watched if a rule matches pods on their priority.
+	var priorities *priorityGetter
+	if config.matchesPriority() {
+		priorityClasses := factory.Scheduling().V1().PriorityClasses()
+		priorityClassInformer := priorityClasses.Informer()
+		if trackErr := activity.track("priorityclasses", priorityClassInformer); trackErr != nil {
+			err = fmt.Errorf("name=%s failed to track PriorityClass informer - %s", Name, trackErr.Error())
+			return
+		}
+
+		go priorityClassInformer.Run(stopCh)
+		if !cache.WaitForCacheSync(stopCh, priorityClassInformer.HasSynced) {
+			err = fmt.Errorf("name=%s failed to wait for PriorityClass informer cache to sync", Name)
+			return
+		}
+
+		priorities = newPriorityGetter(priorityClasses.Lister())
+	}
+
+	// The metadata of ReplicaSets and Jobs is only watched if a rule matches
+	// pods of Deployments or CronJobs.
+	var replicaSets, jobs cache.Indexer
+	if config.matchesOwnerKind("Deployment") {
+		replicaSets, err = runOwnerMetadataInformer(kubeClientConfig, resyncPeriod, appsv1.SchemeGroupVersion, "replicasets", activity, stopCh)
+		if err != nil {
+			return
+		}
+	}
+	if config.matchesOwnerKind("CronJob") {
+		jobs, err = runOwnerMetadataInformer(kubeClientConfig, resyncPeriod, batchv1.SchemeGroupVersion, "jobs", activity, stopCh)
+		if err != nil {
+			return
+		}
+	}
+
+	for _, nsInformer := range nsInformers {
+		go nsInformer.Run(stopCh)
+	}
+	go limitRangeInformer.Run(stopCh)
+	go runtimeClassInformer.Run(stopCh)
+
+	for _, nsInformer := range nsInformers {
+		if !cache.WaitForCacheSync(stopCh, nsInformer.HasSynced) {
+			err = fmt.Errorf("name=%s failed to wait for Namespace informer cache to sync", Name)
+			return
+		}
+	}
 
 	if !cache.WaitForCacheSync(stopCh, limitRangeInformer.HasSynced) {
 		err = fmt.Errorf("name=%s failed to wait for LimitRange informer cache to sync", Name)
 		return
 	}
 
+	if !cache.WaitForCacheSync(stopCh, runtimeClassInformer.HasSynced) {
+		err = fmt.Errorf("name=%s failed to wait for RuntimeClass informer cache to sync", Name)
+		return
+	}
+
 	admission = &clusterResourceOverrideAdmission{
-		config:   config,
-		nsLister: namespaces.Lister(),
+		config:     config,
+		namespaces: nsGetter,
 		limitQuerier: &namespaceLimitQuerier{
-			limitRangesLister: limitRanges.Lister(),
+			limitRanges: limitRangeLister,
+			bounds:      bounds,
 		},
+		overheads:  newOverheadGetter(runtimeClasses.Lister()),
+		quotas:     quotas,
+		nodes:      nodes,
+		priorities: priorities,
+		owners:     newOwnerGetter(replicaSets, jobs),
+		recorder:   newEventRecorder(client, stopCh),
+		activity:   activity,
+	}
+
+	return
+}
+
+// runOwnerMetadataInformer starts an informer on the metadata of the given
+// owner resource and returns its indexer once it has synced.
+func runOwnerMetadataInformer(kubeClientConfig *restclient.Config, resyncPeriod time.Duration, groupVersion schema.GroupVersion, resource string, activity *informerActivity, stopCh <-chan struct{}) (indexer cache.Indexer, err error) {
+	informer, informerErr := newOwnerMetadataInformer(kubeClientConfig, resyncPeriod, groupVersion, resource)
+	if informerErr != nil {
+		err = fmt.Errorf("name=%s failed to create %s informer - %s", Name, resource, informerErr.Error())
+		return
+	}
+	if trackErr := activity.track(resource, informer); trackErr != nil {
+		err = fmt.Errorf("name=%s failed to track %s informer - %s", Name, resource, trackErr.Error())
+		return
+	}
+
+	go informer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		err = fmt.Errorf("name=%s failed to wait for %s informer cache to sync", Name, resource)
+		return
 	}
 
+	indexer = informer.GetIndexer()
 	return
 }
 
@@ -165,14 +383,29 @@ var (
 
 type clusterResourceOverrideAdmission struct {
 	config       *Config
-	nsLister     corev1listers.NamespaceLister
+	namespaces   *namespaceGetter
 	limitQuerier *namespaceLimitQuerier
+	overheads    *overheadGetter
+	quotas       []QuotaSource
+	nodes        *nodeCapacity
+	priorities   *priorityGetter
+	owners       *ownerGetter
+	recorder     record.EventRecorder
+	activity     *informerActivity
 }
 
 func (p *clusterResourceOverrideAdmission) GetConfiguration() *Config {
 	return p.config
 }
 
+func (p *clusterResourceOverrideAdmission) HasSynced() bool {
+	return p.activity.HasSynced()
+}
+
+func (p *clusterResourceOverrideAdmission) CheckStaleness() error {
+	return p.activity.CheckStaleness()
+}
+
 func (p *clusterResourceOverrideAdmission) IsApplicable(request *admissionv1.AdmissionRequest) bool {
 	if request.Resource.Resource == string(corev1.ResourcePods) &&
 		request.SubResource == "" && request.Operation == admissionv1.Create {
@@ -180,18 +413,43 @@ func (p *clusterResourceOverrideAdmission) IsApplicable(request *admissionv1.Adm
 		return true
 	}
 
+	// in-place resize of the containers of a running pod.
+	if request.Resource.Resource == string(corev1.ResourcePods) &&
+		request.SubResource == ResizeSubResource && request.Operation == admissionv1.Update {
+
+		return true
+	}
+
+	// debug containers added to a running pod.
+	if request.Resource.Resource == string(corev1.ResourcePods) &&
+		request.SubResource == EphemeralContainersSubResource && request.Operation == admissionv1.Update {
+
+		return true
+	}
+
 	return false
 }
 
-func (p *clusterResourceOverrideAdmission) IsExempt(request *admissionv1.AdmissionRequest) (exempt bool, selinuxExempt bool, response *admissionv1.AdmissionResponse) {
+func (p *clusterResourceOverrideAdmission) IsExempt(ctx context.Context, request *admissionv1.AdmissionRequest) (exempt bool, selinuxExempt bool, response *admissionv1.AdmissionResponse) {
+	ctx, span := tracing.Start(ctx, "IsExempt", tracing.NamespaceKey.String(request.Namespace))
+	defer span.End()
+
 	// we enforce an opt-in model.
 	// all resource(s) are by default exempt unless the containing namespace has the right label.
 	exempt = true
 	selinuxExempt = true
 
-	ns, err := p.nsLister.Get(request.Namespace)
+	ns, err := p.namespaces.Get(ctx, request.Namespace)
 	if err != nil {
 		klog.Warningf("namespace=%s error retrieving namespace: %v", request.Namespace, err)
+		span.RecordError(err)
+		if response = p.failOpen(ctx, request, nil, metrics.ReasonNamespaceLookup, err); response != nil {
+			return
+		}
+
+		recordFailure(ctx, request.Namespace, metrics.ReasonNamespaceLookup, err)
+		p.recordEvent(eventTarget(nil, request.Namespace), corev1.EventTypeWarning, EventReasonNamespaceLookupFailed,
+			fmt.Sprintf("Pod admission was rejected, the namespace could not be retrieved: %v", err))
 		response = admissionresponse.WithForbidden(request, err)
 		return
 	}
@@ -218,46 +476,249 @@ func (p *clusterResourceOverrideAdmission) IsExempt(request *admissionv1.Admissi
 	return
 }
 
-func (p *clusterResourceOverrideAdmission) Admit(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+func (p *clusterResourceOverrideAdmission) Admit(ctx context.Context, request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
 	klog.V(5).Infof("namespace=%s - admitting resource", request.Namespace)
 
-	pod, err := getPod(request)
+	pod, err := getPod(request.Object)
 	if err != nil {
+		recordFailure(ctx, request.Namespace, metrics.ReasonBadRequest, err)
 		return admissionresponse.WithBadRequest(request, err)
 	}
 
+	var old *corev1.Pod
+	if request.SubResource == ResizeSubResource || request.SubResource == EphemeralContainersSubResource {
+		old, err = getPod(request.OldObject)
+		if err != nil {
+			recordFailure(ctx, request.Namespace, metrics.ReasonBadRequest, err)
+			return admissionresponse.WithBadRequest(request, err)
+		}
+	}
+	DecisionFrom(ctx).setPod(pod.Name, pod.GenerateName)
+
 	// Don't mutate resource requirements below the namespace
 	// limit minimums.
-	nsMinimum, nsMaximum, err := p.limitQuerier.QueryFloorAndCeiling(request.Namespace)
+	bounds, err := p.limitQuerier.QueryBounds(ctx, request.Namespace)
 	if err != nil {
+		if response := p.failOpen(ctx, request, pod, metrics.ReasonLimitRange, err); response != nil {
+			return response
+		}
+
+		recordFailure(ctx, request.Namespace, metrics.ReasonLimitRange, err)
+		p.recordEvent(eventTarget(pod, request.Namespace), corev1.EventTypeWarning, EventReasonLimitRangeQueryFailed,
+			fmt.Sprintf("Pod admission was rejected, the namespace LimitRanges could not be queried: %v", err))
 		return admissionresponse.WithForbidden(request, err)
 	}
-	klog.V(5).Infof("namespace=%s LimitRange query - minimum=%v maximum=%v", request.Namespace, nsMinimum, nsMaximum)
+	klog.V(5).Infof("namespace=%s LimitRange query - minimum=%v maximum=%v podMinimum=%v podMaximum=%v", request.Namespace, bounds.floor, bounds.ceiling, bounds.podFloor, bounds.podCeiling)
 
 	klog.V(5).Infof("namespace=%s initial pod: initContainers=%#v containers=%#v", request.Namespace, pod.Spec.InitContainers, pod.Spec.Containers)
 
-	mutator, err := NewMutator(p.config, setNamespaceFloor(nsMinimum), nsMaximum, cpuBaseScaleFactor)
+	input, err := p.ruleInput(ctx, request.Namespace, pod)
 	if err != nil {
+		if response := p.failOpen(ctx, request, pod, metrics.ReasonNamespaceLookup, err); response != nil {
+			return response
+		}
+
+		recordFailure(ctx, request.Namespace, metrics.ReasonNamespaceLookup, err)
+		p.recordEvent(eventTarget(pod, request.Namespace), corev1.EventTypeWarning, EventReasonNamespaceLookupFailed,
+			fmt.Sprintf("Pod admission was rejected, the namespace could not be retrieved: %v", err))
+		return admissionresponse.WithForbidden(request, err)
+	}
+
+	config, err := p.config.ForPod(pod, input)
+	if err != nil {
+		if response := p.failOpen(ctx, request, pod, metrics.ReasonMutation, err); response != nil {
+			return response
+		}
+
+		recordFailure(ctx, request.Namespace, metrics.ReasonMutation, err)
+		return admissionresponse.WithInternalServerError(request, err)
+	}
+	if config.Rule != "" {
+		klog.V(5).Infof("namespace=%s pod matches rule %s", request.Namespace, config.Rule)
+	}
+
+	mutator, err := NewMutator(config, setNamespaceFloor(bounds.floor), bounds.ceiling, cpuBaseScaleFactor)
+	if err != nil {
+		if response := p.failOpen(ctx, request, pod, metrics.ReasonMutation, err); response != nil {
+			return response
+		}
+
+		recordFailure(ctx, request.Namespace, metrics.ReasonMutation, err)
 		return admissionresponse.WithInternalServerError(request, err)
 	}
+	mutator.SetPodBounds(bounds.podFloor, bounds.podCeiling)
+	mutator.SetLimitRequestRatios(bounds.limitRequestRatio, bounds.podLimitRequestRatio)
+	mutator.SetOverhead(p.overheads.Get(pod))
+	if input != nil {
+		mutator.SetNamespace(input.Namespace)
+	}
+	if p.config.QuotaAction != "" && request.SubResource == "" {
+		mutator.SetQuotaHeadroom(p.quotaHeadroom(request.Namespace))
+	}
+	if p.config.CapToNodeAllocatable && request.SubResource == "" {
+		mutator.SetNodeCapacity(p.nodes.Largest(pod))
+	}
 
-	current, err := mutator.Mutate(pod)
+	_, span := tracing.Start(ctx, "Mutate", tracing.NamespaceKey.String(request.Namespace),
+		tracing.ContainerCountKey.Int(len(pod.Spec.InitContainers)+len(pod.Spec.Containers)))
+	var current *corev1.Pod
+	switch request.SubResource {
+	case ResizeSubResource:
+		current, err = mutator.MutateResize(old, pod)
+	case EphemeralContainersSubResource:
+		if rejectErr := mutator.ValidateEphemeralContainers(old, pod); rejectErr != nil {
+			span.End()
+			return p.rejectEphemeralContainers(ctx, request, pod, rejectErr)
+		}
+		current, err = mutator.MutateEphemeralContainers(old, pod)
+	default:
+		current, err = mutator.Mutate(pod)
+	}
+	span.End()
 	if err != nil {
+		if response := p.failOpen(ctx, request, pod, metrics.ReasonMutation, err); response != nil {
+			return response
+		}
+
+		recordFailure(ctx, request.Namespace, metrics.ReasonMutation, err)
 		return admissionresponse.WithInternalServerError(request, err)
 	}
 
+	if quotaErr := mutator.CheckQuota(pod, current); quotaErr != nil {
+		return p.rejectQuota(ctx, request, pod, quotaErr)
+	}
+
 	klog.V(5).Infof("namespace=%s pod limits after overrides are: initContainers=%#v containers=%#v", request.Namespace, current.Spec.InitContainers, current.Spec.Containers)
 
-	patch, patchErr := Patch(request.Object, current)
+	_, span = tracing.Start(ctx, "Patch", tracing.NamespaceKey.String(request.Namespace))
+	patch, patchErr := Patch(mutator.Operations())
+	span.End()
 	if patchErr != nil {
+		if response := p.failOpen(ctx, request, pod, metrics.ReasonPatch, patchErr); response != nil {
+			return response
+		}
+
+		recordFailure(ctx, request.Namespace, metrics.ReasonPatch, patchErr)
 		return admissionresponse.WithInternalServerError(request, patchErr)
 	}
 
-	return admissionresponse.WithPatch(request, patch)
+	unchanged := len(mutator.Operations()) == 0
+	recordMutationMetrics(request.Namespace, mutator.Summary(), patch, unchanged)
+	DecisionFrom(ctx).setMutation(config, mutator.Summary(), unchanged)
+	if clamps := mutator.Summary().Clamps(); len(clamps) > 0 {
+		p.recordEvent(eventTarget(pod, request.Namespace), corev1.EventTypeNormal, EventReasonResourcesClamped, clampEventMessage(clamps))
+	}
+
+	response := withMutationAuditAnnotations(admissionresponse.WithPatch(request, patch), config, mutator.Summary())
+	if warning := nodeCapacityWarning(mutator.Summary().Clamps()); warning != "" {
+		response = admissionresponse.WithWarning(response, warning)
+	}
+
+	return response
+}
+
+// rejectEphemeralContainers denies ephemeral containers the configuration
+// does not allow.
+func (p *clusterResourceOverrideAdmission) rejectEphemeralContainers(ctx context.Context, request *admissionv1.AdmissionRequest, pod *corev1.Pod, err error) *admissionv1.AdmissionResponse {
+	klog.V(3).Infof("namespace=%s rejecting ephemeral containers of pod %s - %v", request.Namespace, request.Name, err)
+	return p.reject(ctx, request, pod, metrics.ReasonEphemeralContainers, EventReasonEphemeralRejected,
+		fmt.Sprintf("Ephemeral container was rejected: %v", err), err)
+}
+
+// rejectQuota denies a pod the overrides push over a quota of its namespace,
+// before the quota admission denies it with an error that does not mention
+// the overrides.
+func (p *clusterResourceOverrideAdmission) rejectQuota(ctx context.Context, request *admissionv1.AdmissionRequest, pod *corev1.Pod, err error) *admissionv1.AdmissionResponse {
+	klog.V(3).Infof("namespace=%s rejecting pod %s - %v", request.Namespace, pod.GenerateName+pod.Name, err)
+	return p.reject(ctx, request, pod, metrics.ReasonResourceQuota, EventReasonQuotaExceeded,
+		fmt.Sprintf("Pod admission was rejected: %v", err), err)
+}
+
+// reject denies a request the configuration does not allow. Unlike a failure,
+// a rejection is not subject to the failure policy.
+func (p *clusterResourceOverrideAdmission) reject(ctx context.Context, request *admissionv1.AdmissionRequest, pod *corev1.Pod, reason, eventReason, message string, err error) *admissionv1.AdmissionResponse {
+	metrics.RecordRequest(request.Namespace, metrics.OutcomeRejected, reason)
+	DecisionFrom(ctx).setRejected(reason, err)
+	p.recordEvent(eventTarget(pod, request.Namespace), corev1.EventTypeWarning, eventReason, message)
+
+	return admissionresponse.WithAuditAnnotation(admissionresponse.WithForbidden(request, err), AuditRejectedKey, reason)
+}
+
+// quotaHeadroom returns what is left of the quotas of the namespace. Quotas
+// that can not be listed are not checked.
+func (p *clusterResourceOverrideAdmission) quotaHeadroom(namespace string) quotaHeadroom {
+	all := []Quota{}
+	for _, source := range p.quotas {
+		quotas, err := source.ForNamespace(namespace)
+		if err != nil {
+			klog.Warningf("namespace=%s ignoring quotas - %v", namespace, err)
+			continue
+		}
+		all = append(all, quotas...)
+	}
+
+	return newQuotaHeadroom(all)
+}
+
+// ruleInput returns what rules match the pod on besides the pod itself, or
+// nil if the configuration has no rules.
+func (p *clusterResourceOverrideAdmission) ruleInput(ctx context.Context, namespace string, pod *corev1.Pod) (*RuleInput, error) {
+	if len(p.config.Rules) == 0 {
+		return nil, nil
+	}
+
+	input := &RuleInput{
+		Priority:   p.priorities.Get(pod),
+		OwnerKinds: p.owners.Kinds(namespace, pod),
+	}
+
+	if p.config.hasExpressions() {
+		ns, err := p.namespaces.Get(ctx, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get namespace %s for rule expressions - %s", namespace, err.Error())
+		}
+		input.Namespace = ns
+	}
+
+	return input, nil
+}
+
+// recordFailure records why an admission request was denied.
+func recordFailure(ctx context.Context, namespace, reason string, err error) {
+	metrics.RecordRequest(namespace, metrics.OutcomeError, reason)
+	DecisionFrom(ctx).setFailure(reason, err)
+}
+
+// recordMutationMetrics records an admitted pod, with the unchanged outcome
+// if the overrides left it as it was.
+func recordMutationMetrics(namespace string, summary *MutationSummary, patch []byte, unchanged bool) {
+	if unchanged {
+		metrics.RecordRequest(namespace, metrics.OutcomeUnchanged, "")
+		return
+	}
+
+	metrics.RecordRequest(namespace, metrics.OutcomeMutated, "")
+	metrics.ObservePatchSize(len(patch))
+
+	if summary == nil {
+		return
+	}
+
+	for _, clamp := range summary.Clamps() {
+		metrics.RecordClamp(namespace, string(clamp.Resource), clamp.Field, clamp.Bound)
+	}
+
+	for i := range summary.Containers {
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			if ratio, ok := summary.Containers[i].RequestRatio(name); ok {
+				metrics.ObserveRequestRatio(namespace, string(name), ratio)
+			}
+		}
+	}
 }
 
-func getPod(request *admissionv1.AdmissionRequest) (pod *corev1.Pod, err error) {
+func getPod(object runtime.RawExtension) (pod *corev1.Pod, err error) {
 	pod = &corev1.Pod{}
-	err = json.Unmarshal(request.Object.Raw, pod)
+	err = json.Unmarshal(object.Raw, pod)
 	return
 }
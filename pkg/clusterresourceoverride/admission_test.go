@@ -8,6 +8,7 @@ import (
 	admissionv1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	restclient "k8s.io/client-go/rest"
 
 	"k8s.io/apimachinery/pkg/api/resource"
 )
@@ -32,8 +33,41 @@ func TestSetNamespaceFloor(t *testing.T) {
 }
 
 // TestOverrideHookUpdatesNotApplicable tests to make sure that admission
-// regards UPDATE requests to a pod as not applicable, as currently kubernetes
-// doesn't allow the resource fields to be updated in-place
+// regards UPDATE requests to a pod as not applicable, as kubernetes only
+// allows the resource fields to be updated in-place through the resize
+// subresource
+func TestNewAdmissionWithInvalidConfiguration(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr string
+	}{
+		{
+			name:    "WithInvalidSetting",
+			config:  &Config{CPULimitMode: "Unbounded"},
+			wantErr: "cpuLimitMode must be one of",
+		},
+		{
+			name:    "WithInvalidSettingAndPercent",
+			config:  &Config{MemoryRequestToLimitRatio: 1.5, QuotaAction: "Ignore"},
+			wantErr: "resourceQuota.action must be one of",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errGot := NewAdmission(&restclient.Config{}, nil, func() (*Config, error) {
+				return tt.config, nil
+			})
+
+			require.Error(t, errGot)
+			assert.Contains(t, errGot.Error(), tt.wantErr)
+			// top-level percents out of range are only a warning.
+			assert.NotContains(t, errGot.Error(), "memoryRequestToLimitPercent")
+		})
+	}
+}
+
 func TestAdmissionUpdateRequestsNotApplicable(t *testing.T) {
 	admission := clusterResourceOverrideAdmission{}
 	req := &admissionv1.AdmissionRequest{
@@ -44,3 +78,16 @@ func TestAdmissionUpdateRequestsNotApplicable(t *testing.T) {
 	applicable := admission.IsApplicable(req)
 	assert.False(t, applicable)
 }
+
+func TestAdmissionResizeRequestsApplicable(t *testing.T) {
+	admission := clusterResourceOverrideAdmission{}
+	req := &admissionv1.AdmissionRequest{
+		Operation:   "UPDATE",
+		Resource:    metav1.GroupVersionResource{Resource: string(corev1.ResourcePods)},
+		SubResource: ResizeSubResource,
+	}
+	assert.True(t, admission.IsApplicable(req))
+
+	req.SubResource = "status"
+	assert.False(t, admission.IsApplicable(req))
+}
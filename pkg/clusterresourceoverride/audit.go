@@ -0,0 +1,67 @@
+package clusterresourceoverride
+
+import (
+	"fmt"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+
+	admissionresponse "github.com/openshift/cluster-resource-override-admission/pkg/response"
+)
+
+// Keys of the audit annotations set on admission responses. The API server
+// prefixes each of them with the name of the webhook.
+const (
+	AuditConfigVersionKey = "config-version"
+	AuditMutationsKey     = "mutations"
+	AuditRuleKey          = "rule"
+	AuditPodMutationKey   = "pod-mutation"
+	AuditOverheadHeavyKey = "overhead-heavy"
+	AuditQoSChangeKey     = "qos-change"
+	AuditQoSActionKey     = "qos-action"
+	AuditEphemeralKey     = "ephemeral-containers"
+	AuditRejectedKey      = "rejected"
+	AuditClampsKey        = "clamps"
+	AuditExemptReasonKey  = "exempt-reason"
+	AuditFailedOpenKey    = "failed-open"
+)
+
+var (
+	// ExemptReasonNamespaceNotEnabled explains why pods in a namespace that has
+	// not opted in are left untouched.
+	ExemptReasonNamespaceNotEnabled = fmt.Sprintf("namespace is not labeled %s=true", EnabledLabelName)
+)
+
+// withMutationAuditAnnotations records the configuration in use and what the
+// mutator did to each container on the given response.
+func withMutationAuditAnnotations(response *admissionv1.AdmissionResponse, config *Config, summary *MutationSummary) *admissionv1.AdmissionResponse {
+	response = admissionresponse.WithAuditAnnotation(response, AuditConfigVersionKey, config.Version)
+	if config.Rule != "" {
+		response = admissionresponse.WithAuditAnnotation(response, AuditRuleKey, config.Rule)
+	}
+	if summary == nil {
+		return response
+	}
+
+	response = admissionresponse.WithAuditAnnotationJSON(response, AuditMutationsKey, summary.Containers)
+	if summary.Pod != nil {
+		response = admissionresponse.WithAuditAnnotationJSON(response, AuditPodMutationKey, summary.Pod)
+	}
+	if summary.OverheadHeavy {
+		response = admissionresponse.WithAuditAnnotation(response, AuditOverheadHeavyKey, "true")
+	}
+	if change := summary.QoSChange(); change != "" {
+		response = admissionresponse.WithAuditAnnotation(response, AuditQoSChangeKey, change)
+	}
+	if summary.QoSAction != "" {
+		response = admissionresponse.WithAuditAnnotation(response, AuditQoSActionKey, summary.QoSAction)
+	}
+	if len(summary.EphemeralContainers) > 0 {
+		response = admissionresponse.WithAuditAnnotation(response, AuditEphemeralKey, strings.Join(summary.EphemeralContainers, ","))
+	}
+	if clamps := summary.Clamps(); len(clamps) > 0 {
+		response = admissionresponse.WithAuditAnnotationJSON(response, AuditClampsKey, clamps)
+	}
+
+	return response
+}
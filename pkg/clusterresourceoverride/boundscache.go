@@ -0,0 +1,145 @@
+package clusterresourceoverride
+
+import (
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/tools/cache"
+)
+
+// namespaceBounds is the floor and ceiling of containers and of pods computed
+// from the LimitRanges of a namespace. It is shared by concurrent requests
+// and must not be modified.
+type namespaceBounds struct {
+	// resourceVersions maps the name of each LimitRange the bounds were
+	// computed from to its resourceVersion.
+	resourceVersions map[string]string
+	floor            *CPUMemory
+	ceiling          *CPUMemory
+	podFloor         *CPUMemory
+	podCeiling       *CPUMemory
+
+	// limitRequestRatio and podLimitRequestRatio are the largest ratios of
+	// limit to request allowed for containers and for pods.
+	limitRequestRatio    *CPUMemory
+	podLimitRequestRatio *CPUMemory
+}
+
+// matches returns true if the bounds were computed from exactly the given LimitRanges.
+func (b *namespaceBounds) matches(limitRanges []*corev1.LimitRange) bool {
+	if len(b.resourceVersions) != len(limitRanges) {
+		return false
+	}
+
+	for _, limitRange := range limitRanges {
+		if version, ok := b.resourceVersions[limitRange.Name]; !ok || version != limitRange.ResourceVersion {
+			return false
+		}
+	}
+
+	return true
+}
+
+// boundsCache caches the bounds of each namespace, keyed by the
+// resourceVersions of its LimitRanges. Entries are dropped as soon as the
+// informer observes a change to a LimitRange of the namespace, so that the
+// cache holds no more namespaces than have LimitRanges. A nil cache caches
+// nothing.
+type boundsCache struct {
+	lock   sync.RWMutex
+	bounds map[string]*namespaceBounds
+}
+
+func newBoundsCache() *boundsCache {
+	return &boundsCache{
+		bounds: map[string]*namespaceBounds{},
+	}
+}
+
+// get returns the cached bounds of the namespace if they were computed from
+// the given LimitRanges.
+func (c *boundsCache) get(namespace string, limitRanges []*corev1.LimitRange) (bounds *namespaceBounds, found bool) {
+	if c == nil {
+		return
+	}
+
+	c.lock.RLock()
+	cached, ok := c.bounds[namespace]
+	c.lock.RUnlock()
+
+	if !ok || !cached.matches(limitRanges) {
+		return
+	}
+
+	return cached, true
+}
+
+// add caches the given bounds, recording the LimitRanges they were computed
+// from. Bounds of namespaces without LimitRanges are cheap to compute and not
+// cached, no event would drop them once the namespace is deleted.
+func (c *boundsCache) add(namespace string, limitRanges []*corev1.LimitRange, bounds *namespaceBounds) {
+	if c == nil || len(limitRanges) == 0 {
+		return
+	}
+
+	versions := make(map[string]string, len(limitRanges))
+	for _, limitRange := range limitRanges {
+		versions[limitRange.Name] = limitRange.ResourceVersion
+	}
+
+	// Quantity caches its string representation the first time it is
+	// formatted, do it now so that concurrent readers don't write to it.
+	for _, bound := range []*CPUMemory{bounds.floor, bounds.ceiling, bounds.podFloor, bounds.podCeiling, bounds.limitRequestRatio, bounds.podLimitRequestRatio} {
+		if bound == nil {
+			continue
+		}
+
+		for _, quantity := range []*resource.Quantity{bound.CPU, bound.Memory} {
+			if quantity != nil {
+				_ = quantity.String()
+			}
+		}
+	}
+	bounds.resourceVersions = versions
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.bounds[namespace] = bounds
+}
+
+func (c *boundsCache) invalidate(namespace string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.bounds, namespace)
+}
+
+// handler returns an event handler that drops the cached bounds of the
+// namespace of every LimitRange the informer observes a change to.
+func (c *boundsCache) handler() cache.ResourceEventHandler {
+	invalidate := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+
+		if limitRange, ok := obj.(*corev1.LimitRange); ok {
+			c.invalidate(limitRange.Namespace)
+		}
+	}
+
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: invalidate,
+		UpdateFunc: func(old, obj interface{}) {
+			// resyncs deliver updates without changes.
+			if oldLimitRange, ok := old.(*corev1.LimitRange); ok {
+				if limitRange, ok := obj.(*corev1.LimitRange); ok && limitRange.ResourceVersion == oldLimitRange.ResourceVersion {
+					return
+				}
+			}
+			invalidate(obj)
+		},
+		DeleteFunc: invalidate,
+	}
+}
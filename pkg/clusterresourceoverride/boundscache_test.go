@@ -0,0 +1,202 @@
+package clusterresourceoverride
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestLimitRange(name, resourceVersion, cpuMin, memoryMax string) *corev1.LimitRange {
+	return &corev1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "foo", ResourceVersion: resourceVersion},
+		Spec: corev1.LimitRangeSpec{
+			Limits: []corev1.LimitRangeItem{
+				{
+					Type: corev1.LimitTypeContainer,
+					Min:  corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpuMin)},
+					Max:  corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(memoryMax)},
+				},
+			},
+		},
+	}
+}
+
+// newTestLimitQuerier returns a querier over the given LimitRanges of the
+// namespace foo, which exists for long enough to be read from the cache only.
+func newTestLimitQuerier(tb testing.TB, bounds *boundsCache, limitRanges ...*corev1.LimitRange) (*namespaceLimitQuerier, cache.Indexer) {
+	nsIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	require.NoError(tb, nsIndexer.Add(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour))},
+	}))
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, limitRange := range limitRanges {
+		require.NoError(tb, indexer.Add(limitRange))
+	}
+
+	namespaces := newNamespaceGetter(corev1listers.NewNamespaceLister(nsIndexer), nil)
+	return &namespaceLimitQuerier{
+		limitRanges: newLimitRangeLister(corev1listers.NewLimitRangeLister(indexer), namespaces, nil),
+		bounds:      bounds,
+	}, indexer
+}
+
+func TestBoundsCache(t *testing.T) {
+	bounds := newBoundsCache()
+	querier, indexer := newTestLimitQuerier(t, bounds, newTestLimitRange("limits", "1", "100m", "1Gi"))
+
+	boundsGot, err := querier.QueryBounds(context.TODO(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "100m", boundsGot.floor.CPU.String())
+	assert.Equal(t, "1Gi", boundsGot.ceiling.Memory.String())
+
+	cached, found := bounds.get("foo", []*corev1.LimitRange{newTestLimitRange("limits", "1", "100m", "1Gi")})
+	require.True(t, found)
+	assert.Same(t, boundsGot, cached)
+
+	// the cached bounds are not used once a LimitRange changes, even if the
+	// informer has not told the cache yet.
+	require.NoError(t, indexer.Update(newTestLimitRange("limits", "2", "200m", "1Gi")))
+	boundsGot, err = querier.QueryBounds(context.TODO(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "200m", boundsGot.floor.CPU.String())
+
+	require.NoError(t, indexer.Add(newTestLimitRange("more-limits", "3", "300m", "2Gi")))
+	boundsGot, err = querier.QueryBounds(context.TODO(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "200m", boundsGot.floor.CPU.String())
+	assert.Equal(t, "2Gi", boundsGot.ceiling.Memory.String())
+}
+
+func TestBoundsCacheWithoutLimitRanges(t *testing.T) {
+	bounds := newBoundsCache()
+	querier, _ := newTestLimitQuerier(t, bounds)
+
+	_, err := querier.QueryBounds(context.TODO(), "foo")
+	require.NoError(t, err)
+
+	_, found := bounds.get("foo", nil)
+	assert.False(t, found)
+	assert.Empty(t, bounds.bounds)
+}
+
+func TestBoundsCacheHandler(t *testing.T) {
+	limitRange := newTestLimitRange("limits", "1", "100m", "1Gi")
+	limitRanges := []*corev1.LimitRange{limitRange}
+	namespace := &namespaceBounds{floor: &CPUMemory{}, ceiling: &CPUMemory{}}
+
+	bounds := newBoundsCache()
+	handler := bounds.handler()
+
+	bounds.add("foo", limitRanges, namespace)
+	handler.OnUpdate(limitRange, limitRange.DeepCopy())
+	_, found := bounds.get("foo", limitRanges)
+	assert.True(t, found, "a resync must not drop the cached bounds")
+
+	updated := newTestLimitRange("limits", "2", "200m", "1Gi")
+	handler.OnUpdate(limitRange, updated)
+	_, found = bounds.get("foo", limitRanges)
+	assert.False(t, found)
+
+	bounds.add("foo", limitRanges, namespace)
+	handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "foo/limits", Obj: limitRange})
+	_, found = bounds.get("foo", limitRanges)
+	assert.False(t, found)
+}
+
+func BenchmarkQueryBounds(b *testing.B) {
+	limitRanges := []*corev1.LimitRange{
+		newTestLimitRange("limits", "1", "100m", "1Gi"),
+		newTestLimitRange("more-limits", "2", "200m", "2Gi"),
+	}
+
+	for _, bc := range []struct {
+		name   string
+		bounds *boundsCache
+	}{
+		{name: "Uncached"},
+		{name: "Cached", bounds: newBoundsCache()},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			querier, _ := newTestLimitQuerier(b, bc.bounds, limitRanges...)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := querier.QueryBounds(context.TODO(), "foo"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAdmit(b *testing.B) {
+	limitRanges := []*corev1.LimitRange{
+		newTestLimitRange("limits", "1", "100m", "1Gi"),
+		newTestLimitRange("more-limits", "2", "200m", "2Gi"),
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "foo"},
+	}
+	for i := 0; i < 3; i++ {
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{
+			Name: fmt.Sprintf("container-%d", i),
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{
+					corev1.ResourceMemory: resource.MustParse("512Mi"),
+				},
+			},
+		})
+	}
+	raw, err := json.Marshal(pod)
+	require.NoError(b, err)
+
+	request := &admissionv1.AdmissionRequest{
+		Namespace: "foo",
+		Operation: admissionv1.Create,
+		Resource:  metav1.GroupVersionResource{Resource: string(corev1.ResourcePods)},
+		Object:    runtime.RawExtension{Raw: raw},
+	}
+
+	for _, bc := range []struct {
+		name   string
+		bounds *boundsCache
+	}{
+		{name: "Uncached"},
+		{name: "Cached", bounds: newBoundsCache()},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			querier, _ := newTestLimitQuerier(b, bc.bounds, limitRanges...)
+			admission := &clusterResourceOverrideAdmission{
+				config: &Config{
+					LimitCPUToMemoryRatio:     2,
+					CpuRequestToLimitRatio:    0.25,
+					MemoryRequestToLimitRatio: 0.5,
+				},
+				limitQuerier: querier,
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if response := admission.Admit(context.TODO(), request); !response.Allowed {
+					b.Fatal(response.Result.Message)
+				}
+			}
+		})
+	}
+}
@@ -1,11 +1,18 @@
 package clusterresourceoverride
 
 import (
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"os"
+	"slices"
+	"strings"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/yaml"
 )
 
@@ -38,6 +45,248 @@ type ClusterResourceOverrideSpec struct {
 	// CPURequestToRequestPercent (if > 0) overrides CPU request to a percentage of the
 	// existing CPU request.
 	CPURequestToRequestPercent int64 `json:"cpuRequestToRequestPercent"`
+
+	// CPULimitMode decides what the CPU limit of containers is set to once
+	// their CPU request has been overridden, FromMemory if not set.
+	CPULimitMode CPULimitMode `json:"cpuLimitMode,omitempty"`
+
+	// CPURequestMultiplePercent sets the CPU limit of containers to a
+	// percentage of their overridden CPU request with CPULimitMode
+	// RequestMultiple.
+	CPURequestMultiplePercent int64 `json:"cpuRequestMultiplePercent,omitempty"`
+
+	// CPULimitToRequestPercent (if > 0) sets the CPU limit of containers that
+	// have a CPU request but no limit to a percentage of the request.
+	CPULimitToRequestPercent int64 `json:"cpuLimitToRequestPercent,omitempty"`
+
+	// MemoryLimitToRequestPercent (if > 0) sets the memory limit of containers
+	// that have a memory request but no limit to a percentage of the request.
+	MemoryLimitToRequestPercent int64 `json:"memoryLimitToRequestPercent,omitempty"`
+
+	// FailurePolicy (if set) decides, per class of error, whether pods are
+	// denied or admitted unmodified when the webhook fails to handle them.
+	FailurePolicy *FailurePolicy `json:"failurePolicy,omitempty"`
+
+	// ContainerClasses (if set) changes the ratios applied to, or skips, init
+	// containers, native sidecar containers or regular containers.
+	ContainerClasses *ContainerClasses `json:"containerClasses,omitempty"`
+
+	// OverheadHeavyPods (if set) changes the ratios applied to, or skips,
+	// pods whose RuntimeClass overhead is a large share of their requests.
+	OverheadHeavyPods *OverheadHeavyPods `json:"overheadHeavyPods,omitempty"`
+
+	// EphemeralContainers (if set) decides how debug containers added to
+	// running pods are handled.
+	EphemeralContainers *EphemeralContainers `json:"ephemeralContainers,omitempty"`
+
+	// QoS (if set) keeps the overrides from changing the QoS class of pods.
+	QoS *QoSPolicy `json:"qos,omitempty"`
+
+	// ResourceQuota (if set) keeps the overrides from pushing pods over the
+	// quotas of their namespace.
+	ResourceQuota *ResourceQuotaPolicy `json:"resourceQuota,omitempty"`
+
+	// CapToNodeAllocatable (if true) keeps the overrides from raising pods
+	// above the largest allocatable of the nodes they can be scheduled to.
+	CapToNodeAllocatable bool `json:"capToNodeAllocatable,omitempty"`
+
+	// Rules change the percents applied to, or skip, the pods they match. The
+	// first rule that matches a pod applies.
+	Rules []Rule `json:"rules,omitempty"`
+
+	// ExpressionCostLimit bounds the cost of evaluating each CEL expression of
+	// the rules, it defaults to the limit of a ValidatingAdmissionPolicy
+	// expression.
+	ExpressionCostLimit int64 `json:"expressionCostLimit,omitempty"`
+}
+
+// Rule holds the settings of the pods it matches. A percent that is not set
+// is inherited from the top level of the spec.
+type Rule struct {
+	// Name identifies the rule in audit annotations.
+	Name string `json:"name"`
+
+	Match RuleMatch `json:"match"`
+
+	ContainerClassOverride `json:",inline"`
+
+	// CPURequestToLimitPercentExpression and
+	// MemoryRequestToLimitPercentExpression are CEL expressions over the pod,
+	// its namespace and a container that compute the percent applied to the
+	// container, in place of the percent of its class.
+	CPURequestToLimitPercentExpression    string `json:"cpuRequestToLimitPercentExpression,omitempty"`
+	MemoryRequestToLimitPercentExpression string `json:"memoryRequestToLimitPercentExpression,omitempty"`
+}
+
+// RuleMatch selects pods. Every criterion that is set must match.
+type RuleMatch struct {
+	// NodeLabel matches pods that can only be scheduled to nodes with the
+	// label, through their nodeSelector or required node affinity.
+	NodeLabel *NodeLabel `json:"nodeLabel,omitempty"`
+
+	// TolerationKey matches pods that tolerate taints with the key.
+	TolerationKey string `json:"tolerationKey,omitempty"`
+
+	// PriorityClassNames matches pods of any of the PriorityClasses.
+	PriorityClassNames []string `json:"priorityClassNames,omitempty"`
+
+	// Priority matches pods whose priority value is within the range.
+	Priority *PriorityRange `json:"priority,omitempty"`
+
+	// Expression is a CEL expression over the pod and its namespace that
+	// matches pods it evaluates to true for.
+	Expression string `json:"expression,omitempty"`
+
+	// OwnerKinds matches pods whose controller is of any of the kinds, such
+	// as StatefulSet or Job. Pods of a Deployment or a CronJob match both
+	// the kind of their controller and Deployment or CronJob.
+	OwnerKinds []string `json:"ownerKinds,omitempty"`
+}
+
+// PriorityRange is a range of priority values, unbounded on the sides that
+// are not set.
+type PriorityRange struct {
+	Min *int32 `json:"min,omitempty"`
+	Max *int32 `json:"max,omitempty"`
+}
+
+// NodeLabel is a label of nodes, with any value if Value is not set.
+type NodeLabel struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// ResourceQuotaPolicy decides what is done with pods the overrides push over
+// a quota of their namespace.
+type ResourceQuotaPolicy struct {
+	Action QuotaAction `json:"action"`
+}
+
+// QuotaAction is what is done with a pod the overrides push over a quota.
+type QuotaAction string
+
+const (
+	// QuotaActionScale scales the overridden containers back within the
+	// quota, never below what they had before the overrides, and rejects the
+	// pod if that is not enough.
+	QuotaActionScale QuotaAction = "Scale"
+
+	// QuotaActionReject rejects the pod, naming the quota and the overrides
+	// that pushed the pod over it.
+	QuotaActionReject QuotaAction = "Reject"
+)
+
+// QoSPolicy decides how the overrides treat the QoS class of pods.
+type QoSPolicy struct {
+	// SkipGuaranteed (if true) leaves the resources of Guaranteed pods untouched.
+	SkipGuaranteed bool `json:"skipGuaranteed,omitempty"`
+
+	// Preserve lists the QoS classes pods keep. Guaranteed pods get requests
+	// equal to their overridden limits, the overrides of other pods whose
+	// class would change are undone.
+	Preserve []corev1.PodQOSClass `json:"preserve,omitempty"`
+
+	// WholeCoreCPU (if true) rounds the overridden CPU of containers that
+	// request exclusive CPUs, a whole number of cores in a Guaranteed pod, up
+	// to whole cores.
+	WholeCoreCPU bool `json:"wholeCoreCPU,omitempty"`
+}
+
+// EphemeralContainers holds the settings of ephemeral containers.
+type EphemeralContainers struct {
+	// RejectWithoutHeadroom (if true) rejects ephemeral containers added to
+	// pods whose containers may already use all of the pod-level CPU or
+	// memory limit, since ephemeral containers have no resources of their own.
+	RejectWithoutHeadroom bool `json:"rejectWithoutHeadroom,omitempty"`
+}
+
+// OverheadHeavyPods holds the settings of pods whose RuntimeClass overhead
+// is a large share of their requests.
+type OverheadHeavyPods struct {
+	// ThresholdPercent is the overhead, as a percent of the CPU or memory
+	// requests of the pod, from which the pod is overhead-heavy.
+	ThresholdPercent int64 `json:"thresholdPercent"`
+
+	ContainerClassOverride `json:",inline"`
+}
+
+// ContainerClasses holds the settings of each class of containers.
+type ContainerClasses struct {
+	// Init applies to init containers that run to completion before the pod starts.
+	Init *ContainerClassOverride `json:"init,omitempty"`
+
+	// Sidecar applies to init containers with restartPolicy Always, which
+	// keep running alongside the regular containers.
+	Sidecar *ContainerClassOverride `json:"sidecar,omitempty"`
+
+	// Regular applies to the containers of the pod.
+	Regular *ContainerClassOverride `json:"regular,omitempty"`
+
+	// CapInitRequests (if true) lowers the requests of init containers that
+	// are not skipped to the sum of the requests of the regular containers
+	// after the overrides, so that init containers don't dominate the
+	// requests of the pod.
+	CapInitRequests bool `json:"capInitRequests,omitempty"`
+}
+
+// ContainerClassOverride holds the settings of a class of containers. A
+// percent that is not set is inherited from the top level of the spec.
+type ContainerClassOverride struct {
+	// Skip (if true) leaves the containers of the class untouched.
+	Skip bool `json:"skip,omitempty"`
+
+	LimitCPUToMemoryPercent     *int64 `json:"limitCPUToMemoryPercent,omitempty"`
+	CPURequestToLimitPercent    *int64 `json:"cpuRequestToLimitPercent,omitempty"`
+	MemoryRequestToLimitPercent *int64 `json:"memoryRequestToLimitPercent,omitempty"`
+	CPURequestToRequestPercent  *int64 `json:"cpuRequestToRequestPercent,omitempty"`
+}
+
+// CPULimitMode decides what the CPU limit of containers is set to.
+type CPULimitMode string
+
+const (
+	// CPULimitModeFromMemory keeps the CPU limit, overridden to a percentage of
+	// the memory limit if LimitCPUToMemoryPercent is set. This is the default.
+	CPULimitModeFromMemory CPULimitMode = "FromMemory"
+
+	// CPULimitModeNone removes the CPU limit, unless a LimitRange of the
+	// namespace requires one.
+	CPULimitModeNone CPULimitMode = "None"
+
+	// CPULimitModeRequestMultiple sets the CPU limit to CPURequestMultiplePercent
+	// of the CPU request.
+	CPULimitModeRequestMultiple CPULimitMode = "RequestMultiple"
+)
+
+// FailureAction is what the webhook does with a pod it failed to handle.
+type FailureAction string
+
+const (
+	// FailClosed denies the pod. This is the default.
+	FailClosed FailureAction = "FailClosed"
+
+	// FailOpen admits the pod unmodified.
+	FailOpen FailureAction = "FailOpen"
+
+	// FailOpenForExemptNamespaces admits the pod unmodified if its namespace
+	// looks like a system namespace (see IsNamespaceExempt), denies it otherwise.
+	FailOpenForExemptNamespaces FailureAction = "FailOpenForExemptNamespaces"
+)
+
+// FailurePolicy holds the action taken for each class of error. An empty
+// action means FailClosed.
+type FailurePolicy struct {
+	// NamespaceLookup applies when the namespace of the pod can not be retrieved.
+	NamespaceLookup FailureAction `json:"namespaceLookup,omitempty"`
+
+	// LimitRange applies when the LimitRanges of the namespace can not be queried.
+	LimitRange FailureAction `json:"limitRange,omitempty"`
+
+	// Mutation applies when the overrides can not be computed.
+	Mutation FailureAction `json:"mutation,omitempty"`
+
+	// Patch applies when the patch can not be built.
+	Patch FailureAction `json:"patch,omitempty"`
 }
 
 type Config struct {
@@ -46,21 +295,428 @@ type Config struct {
 	CpuRequestToLimitRatio    float64
 	MemoryRequestToLimitRatio float64
 	CpuRequestToRequestRatio  float64
+	FailurePolicy             FailurePolicy
+
+	// CPULimitMode decides what the CPU limit is set to, CPURequestMultipleRatio
+	// is the multiple of the CPU request with CPULimitModeRequestMultiple.
+	CPULimitMode            CPULimitMode
+	CPURequestMultipleRatio float64
+
+	// MemoryLimitToRequestRatio and CPULimitToRequestRatio derive the missing
+	// limits of containers from their requests.
+	MemoryLimitToRequestRatio float64
+	CPULimitToRequestRatio    float64
+
+	// Classes holds the settings that differ for a class of containers.
+	Classes map[ContainerClass]ClassConfig
+
+	// CapInitRequests caps the requests of init containers at the sum of the
+	// requests of the regular containers.
+	CapInitRequests bool
+
+	// OverheadHeavy holds the settings of overhead-heavy pods, nil if they
+	// are not treated differently.
+	OverheadHeavy *OverheadConfig
+
+	// RejectEphemeralWithoutHeadroom rejects ephemeral containers added to
+	// pods without headroom under their pod-level limits.
+	RejectEphemeralWithoutHeadroom bool
+
+	// QoS decides how the overrides treat the QoS class of pods.
+	QoS QoSPolicy
+
+	// QuotaAction is what is done with pods the overrides push over a quota,
+	// empty if quotas are not checked.
+	QuotaAction QuotaAction
+
+	// CapToNodeAllocatable caps the overrides to the largest allocatable of
+	// the nodes pods can be scheduled to.
+	CapToNodeAllocatable bool
+
+	// Rules holds the settings of the pods each rule matches.
+	Rules []RuleConfig
+
+	// ExpressionCostLimit bounds the cost of evaluating each expression of
+	// the rules, zero for the default.
+	ExpressionCostLimit int64
+
+	// Rule is the name of the rule the configuration was merged with, if
+	// any, SkipResources is true if the rule skips the pods it matches.
+	Rule          string
+	SkipResources bool
+
+	// expressions are the compiled expressions of the rule the configuration
+	// was merged with, if any.
+	expressions *ruleExpressions
+
+	// ruleOverride holds the percents of the rule the configuration was
+	// merged with, if any, which take precedence over those of container
+	// classes and overhead-heavy pods.
+	ruleOverride *ClassConfig
+
+	// Version identifies the configuration in audit annotations. It is derived
+	// from the spec so that every replica loading the same file reports the same value.
+	Version string
 }
 
 func (c *Config) String() string {
-	return fmt.Sprintf("LimitCPUToMemoryRatio=%f CpuRequestToLimitRatio=%f MemoryRequestToLimitRatio=%f CpuRequestToRequestRatio=%f ForceSelinuxRelabel=%v",
-		c.LimitCPUToMemoryRatio, c.CpuRequestToLimitRatio, c.MemoryRequestToLimitRatio, c.CpuRequestToRequestRatio, c.ForceSelinuxRelabel)
+	return fmt.Sprintf("LimitCPUToMemoryRatio=%f CpuRequestToLimitRatio=%f MemoryRequestToLimitRatio=%f CpuRequestToRequestRatio=%f ForceSelinuxRelabel=%v CPULimitMode=%s CPURequestMultipleRatio=%f CPULimitToRequestRatio=%f MemoryLimitToRequestRatio=%f FailurePolicy=%+v Classes=%v CapInitRequests=%v OverheadHeavy=%v RejectEphemeralWithoutHeadroom=%v QoS=%+v QuotaAction=%s CapToNodeAllocatable=%v Rules=%v ExpressionCostLimit=%d Version=%s",
+		c.LimitCPUToMemoryRatio, c.CpuRequestToLimitRatio, c.MemoryRequestToLimitRatio, c.CpuRequestToRequestRatio, c.ForceSelinuxRelabel, c.CPULimitMode, c.CPURequestMultipleRatio, c.CPULimitToRequestRatio, c.MemoryLimitToRequestRatio, c.FailurePolicy, c.Classes, c.CapInitRequests, c.OverheadHeavy, c.RejectEphemeralWithoutHeadroom, c.QoS, c.QuotaAction, c.CapToNodeAllocatable, c.Rules, c.ExpressionCostLimit, c.Version)
+}
+
+// OverheadConfig holds the settings of pods whose overhead is at least
+// ThresholdRatio of their CPU or memory requests.
+type OverheadConfig struct {
+	ThresholdRatio float64
+	ClassConfig
+}
+
+func (c *OverheadConfig) String() string {
+	if c == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("ThresholdRatio=%f %s", c.ThresholdRatio, c.ClassConfig.String())
+}
+
+// ClassConfig holds the settings of a class of containers. A nil ratio
+// inherits the ratio of the Config.
+type ClassConfig struct {
+	Skip                      bool
+	LimitCPUToMemoryRatio     *float64
+	CpuRequestToLimitRatio    *float64
+	MemoryRequestToLimitRatio *float64
+	CpuRequestToRequestRatio  *float64
+}
+
+func (c ClassConfig) String() string {
+	if c.Skip {
+		return "Skip=true"
+	}
+
+	ratios := []string{}
+	for _, ratio := range []struct {
+		name  string
+		value *float64
+	}{
+		{name: "LimitCPUToMemoryRatio", value: c.LimitCPUToMemoryRatio},
+		{name: "CpuRequestToLimitRatio", value: c.CpuRequestToLimitRatio},
+		{name: "MemoryRequestToLimitRatio", value: c.MemoryRequestToLimitRatio},
+		{name: "CpuRequestToRequestRatio", value: c.CpuRequestToRequestRatio},
+	} {
+		if ratio.value != nil {
+			ratios = append(ratios, fmt.Sprintf("%s=%f", ratio.name, *ratio.value))
+		}
+	}
+
+	return strings.Join(ratios, " ")
 }
 
 func ConvertExternalConfig(object *ClusterResourceOverride) *Config {
-	return &Config{
-		ForceSelinuxRelabel:       object.Spec.ForceSelinuxRelabel,
-		LimitCPUToMemoryRatio:     float64(object.Spec.LimitCPUToMemoryPercent) / 100,
-		CpuRequestToLimitRatio:    float64(object.Spec.CPURequestToLimitPercent) / 100,
-		MemoryRequestToLimitRatio: float64(object.Spec.MemoryRequestToLimitPercent) / 100,
-		CpuRequestToRequestRatio:  float64(object.Spec.CPURequestToRequestPercent) / 100,
+	var failurePolicy FailurePolicy
+	if object.Spec.FailurePolicy != nil {
+		failurePolicy = *object.Spec.FailurePolicy
+	}
+
+	var qos QoSPolicy
+	if object.Spec.QoS != nil {
+		qos = *object.Spec.QoS
+	}
+
+	var quotaAction QuotaAction
+	if object.Spec.ResourceQuota != nil {
+		quotaAction = object.Spec.ResourceQuota.Action
+	}
+
+	config := &Config{
+		FailurePolicy:                  failurePolicy,
+		Classes:                        convertContainerClasses(object.Spec.ContainerClasses),
+		CapInitRequests:                object.Spec.ContainerClasses != nil && object.Spec.ContainerClasses.CapInitRequests,
+		OverheadHeavy:                  convertOverheadHeavyPods(object.Spec.OverheadHeavyPods),
+		RejectEphemeralWithoutHeadroom: object.Spec.EphemeralContainers != nil && object.Spec.EphemeralContainers.RejectWithoutHeadroom,
+		QoS:                            qos,
+		QuotaAction:                    quotaAction,
+		CapToNodeAllocatable:           object.Spec.CapToNodeAllocatable,
+		Rules:                          convertRules(object.Spec.Rules),
+		ExpressionCostLimit:            object.Spec.ExpressionCostLimit,
+		ForceSelinuxRelabel:            object.Spec.ForceSelinuxRelabel,
+		LimitCPUToMemoryRatio:          float64(object.Spec.LimitCPUToMemoryPercent) / 100,
+		CpuRequestToLimitRatio:         float64(object.Spec.CPURequestToLimitPercent) / 100,
+		MemoryRequestToLimitRatio:      float64(object.Spec.MemoryRequestToLimitPercent) / 100,
+		CpuRequestToRequestRatio:       float64(object.Spec.CPURequestToRequestPercent) / 100,
+		CPULimitMode:                   object.Spec.CPULimitMode,
+		CPURequestMultipleRatio:        float64(object.Spec.CPURequestMultiplePercent) / 100,
+		CPULimitToRequestRatio:         float64(object.Spec.CPULimitToRequestPercent) / 100,
+		MemoryLimitToRequestRatio:      float64(object.Spec.MemoryLimitToRequestPercent) / 100,
+		Version:                        specVersion(&object.Spec),
 	}
+	config.compileExpressions()
+
+	return config
+}
+
+func convertContainerClasses(classes *ContainerClasses) map[ContainerClass]ClassConfig {
+	if classes == nil {
+		return nil
+	}
+
+	converted := map[ContainerClass]ClassConfig{}
+	for class, override := range map[ContainerClass]*ContainerClassOverride{
+		ContainerClassInit:    classes.Init,
+		ContainerClassSidecar: classes.Sidecar,
+		ContainerClassRegular: classes.Regular,
+	} {
+		if override == nil {
+			continue
+		}
+
+		converted[class] = convertClassOverride(override)
+	}
+
+	return converted
+}
+
+func convertOverheadHeavyPods(pods *OverheadHeavyPods) *OverheadConfig {
+	if pods == nil {
+		return nil
+	}
+
+	return &OverheadConfig{
+		ThresholdRatio: float64(pods.ThresholdPercent) / 100,
+		ClassConfig:    convertClassOverride(&pods.ContainerClassOverride),
+	}
+}
+
+func convertRules(rules []Rule) []RuleConfig {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	converted := make([]RuleConfig, 0, len(rules))
+	for i := range rules {
+		converted = append(converted, RuleConfig{
+			Name:                                  rules[i].Name,
+			Match:                                 rules[i].Match,
+			ClassConfig:                           convertClassOverride(&rules[i].ContainerClassOverride),
+			CPURequestToLimitPercentExpression:    rules[i].CPURequestToLimitPercentExpression,
+			MemoryRequestToLimitPercentExpression: rules[i].MemoryRequestToLimitPercentExpression,
+		})
+	}
+
+	return converted
+}
+
+func convertClassOverride(override *ContainerClassOverride) ClassConfig {
+	ratio := func(percent *int64) *float64 {
+		if percent == nil {
+			return nil
+		}
+
+		value := float64(*percent) / 100
+		return &value
+	}
+
+	return ClassConfig{
+		Skip:                      override.Skip,
+		LimitCPUToMemoryRatio:     ratio(override.LimitCPUToMemoryPercent),
+		CpuRequestToLimitRatio:    ratio(override.CPURequestToLimitPercent),
+		MemoryRequestToLimitRatio: ratio(override.MemoryRequestToLimitPercent),
+		CpuRequestToRequestRatio:  ratio(override.CPURequestToRequestPercent),
+	}
+}
+
+// ForClass returns the configuration applied to containers of the given
+// class, and whether they are skipped.
+func (c *Config) ForClass(class ContainerClass) (config *Config, skip bool) {
+	override, found := c.Classes[class]
+	if !found {
+		return c, false
+	}
+
+	return c.withRuleOverride(override.apply(c))
+}
+
+// ForOverheadHeavy returns the configuration applied to overhead-heavy pods,
+// and whether they are skipped.
+func (c *Config) ForOverheadHeavy() (config *Config, skip bool) {
+	if c.OverheadHeavy == nil {
+		return c, false
+	}
+
+	return c.withRuleOverride(c.OverheadHeavy.apply(c))
+}
+
+// withRuleOverride applies the percents the rule sets on top of the given
+// configuration, so that a class or overhead-heavy override only changes the
+// percents the rule inherits.
+func (c *Config) withRuleOverride(config *Config, skip bool) (*Config, bool) {
+	if skip || c.ruleOverride == nil {
+		return config, skip
+	}
+
+	override := *c.ruleOverride
+	override.Skip = false
+	return override.apply(config)
+}
+
+// apply returns the given configuration with the ratios that are set replaced.
+func (o ClassConfig) apply(c *Config) (config *Config, skip bool) {
+	if o.Skip {
+		return c, true
+	}
+
+	merged := *c
+	if o.LimitCPUToMemoryRatio != nil {
+		merged.LimitCPUToMemoryRatio = *o.LimitCPUToMemoryRatio
+	}
+	if o.CpuRequestToLimitRatio != nil {
+		merged.CpuRequestToLimitRatio = *o.CpuRequestToLimitRatio
+	}
+	if o.MemoryRequestToLimitRatio != nil {
+		merged.MemoryRequestToLimitRatio = *o.MemoryRequestToLimitRatio
+	}
+	if o.CpuRequestToRequestRatio != nil {
+		merged.CpuRequestToRequestRatio = *o.CpuRequestToRequestRatio
+	}
+
+	return &merged, false
+}
+
+// Validate returns an error aggregating the reasons the configuration can not
+// be applied.
+func (c *Config) Validate() error {
+	return utilerrors.NewAggregate(append(c.validateRatios(""), c.validateSettings()...))
+}
+
+// validateSettings returns the errors of the configuration but its top-level
+// percents, which configurations were accepted with before they were
+// validated.
+func (c *Config) validateSettings() (errs []error) {
+	// overrides are validated on their own, the percents they inherit are
+	// the top-level ones.
+	for _, class := range []ContainerClass{ContainerClassInit, ContainerClassSidecar, ContainerClassRegular} {
+		if override, found := c.Classes[class]; found {
+			if config, skip := override.apply(&Config{}); !skip {
+				errs = append(errs, config.validateRatios(fmt.Sprintf("containerClasses.%s.", class))...)
+			}
+		}
+	}
+
+	// a limit below the request is invalid.
+	if c.CPULimitToRequestRatio != 0 && c.CPULimitToRequestRatio < 1 {
+		errs = append(errs, fmt.Errorf("cpuLimitToRequestPercent must be at least 100"))
+	}
+	if c.MemoryLimitToRequestRatio != 0 && c.MemoryLimitToRequestRatio < 1 {
+		errs = append(errs, fmt.Errorf("memoryLimitToRequestPercent must be at least 100"))
+	}
+	if c.CPURequestMultipleRatio != 0 && c.CPURequestMultipleRatio < 1 {
+		errs = append(errs, fmt.Errorf("cpuRequestMultiplePercent must be at least 100"))
+	}
+
+	switch c.CPULimitMode {
+	case "", CPULimitModeFromMemory, CPULimitModeNone:
+	case CPULimitModeRequestMultiple:
+		if c.CPURequestMultipleRatio == 0 {
+			errs = append(errs, fmt.Errorf("cpuRequestMultiplePercent must be set with cpuLimitMode %s", CPULimitModeRequestMultiple))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("cpuLimitMode must be one of %s, %s or %s", CPULimitModeFromMemory, CPULimitModeNone, CPULimitModeRequestMultiple))
+	}
+
+	switch c.QuotaAction {
+	case "", QuotaActionScale, QuotaActionReject:
+	default:
+		errs = append(errs, fmt.Errorf("resourceQuota.action must be one of %s or %s", QuotaActionScale, QuotaActionReject))
+	}
+
+	for _, class := range c.QoS.Preserve {
+		switch class {
+		case corev1.PodQOSGuaranteed, corev1.PodQOSBurstable, corev1.PodQOSBestEffort:
+		default:
+			errs = append(errs, fmt.Errorf("qos.preserve must only list %s, %s or %s", corev1.PodQOSGuaranteed, corev1.PodQOSBurstable, corev1.PodQOSBestEffort))
+		}
+	}
+
+	if c.OverheadHeavy != nil {
+		if c.OverheadHeavy.ThresholdRatio <= 0 {
+			errs = append(errs, fmt.Errorf("overheadHeavyPods.thresholdPercent must be positive"))
+		}
+
+		if config, skip := c.OverheadHeavy.apply(&Config{}); !skip {
+			errs = append(errs, config.validateRatios("overheadHeavyPods.")...)
+		}
+	}
+
+	if c.ExpressionCostLimit < 0 {
+		errs = append(errs, fmt.Errorf("expressionCostLimit must not be negative"))
+	}
+
+	names := map[string]bool{}
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if rule.Name == "" || names[rule.Name] {
+			errs = append(errs, fmt.Errorf("rules[%d].name must be set and unique", i))
+		}
+		names[rule.Name] = true
+
+		if err := rule.Match.validate(fmt.Sprintf("rules[%s].match", rule.Name)); err != nil {
+			errs = append(errs, err)
+		}
+
+		if config, skip := rule.apply(&Config{}); !skip {
+			errs = append(errs, config.validateRatios(fmt.Sprintf("rules[%s].", rule.Name))...)
+		}
+	}
+
+	if err := c.expressionsErr(); err != nil {
+		errs = append(errs, err)
+	}
+
+	actions := map[string]FailureAction{
+		"failurePolicy.namespaceLookup": c.FailurePolicy.NamespaceLookup,
+		"failurePolicy.limitRange":      c.FailurePolicy.LimitRange,
+		"failurePolicy.mutation":        c.FailurePolicy.Mutation,
+		"failurePolicy.patch":           c.FailurePolicy.Patch,
+	}
+	for _, name := range slices.Sorted(maps.Keys(actions)) {
+		switch actions[name] {
+		case "", FailClosed, FailOpen, FailOpenForExemptNamespaces:
+		default:
+			errs = append(errs, fmt.Errorf("%s must be one of %s, %s or %s", name, FailClosed, FailOpen, FailOpenForExemptNamespaces))
+		}
+	}
+
+	return
+}
+
+func (c *Config) validateRatios(prefix string) (errs []error) {
+	if c.LimitCPUToMemoryRatio < 0 {
+		errs = append(errs, fmt.Errorf("%slimitCPUToMemoryPercent must not be negative", prefix))
+	}
+
+	if c.CpuRequestToRequestRatio < 0 {
+		errs = append(errs, fmt.Errorf("%scpuRequestToRequestPercent must not be negative", prefix))
+	}
+
+	if c.CpuRequestToLimitRatio < 0 || c.CpuRequestToLimitRatio > 1 {
+		errs = append(errs, fmt.Errorf("%scpuRequestToLimitPercent must be between 0 and 100", prefix))
+	}
+
+	if c.MemoryRequestToLimitRatio < 0 || c.MemoryRequestToLimitRatio > 1 {
+		errs = append(errs, fmt.Errorf("%smemoryRequestToLimitPercent must be between 0 and 100", prefix))
+	}
+
+	return
+}
+
+// specVersion returns a short, stable digest of the given spec.
+func specVersion(spec *ClusterResourceOverrideSpec) string {
+	bytes, err := json.Marshal(spec)
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(bytes))[:12]
 }
 
 // DecodeUnstructured decodes a raw stream into a an
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
 )
 
 func TestConvertExternalConfig(t *testing.T) {
@@ -22,6 +24,212 @@ func TestConvertExternalConfig(t *testing.T) {
 	assert.Equal(t, 0.25, configGot.CpuRequestToLimitRatio)
 	assert.Equal(t, 0.50, configGot.MemoryRequestToLimitRatio)
 	assert.Equal(t, 0.25, configGot.CpuRequestToRequestRatio)
+	assert.NotEmpty(t, configGot.Version)
+
+	// the version is stable for the same spec and changes with it.
+	assert.Equal(t, configGot.Version, ConvertExternalConfig(external).Version)
+	external.Spec.CPURequestToLimitPercent = 50
+	assert.NotEqual(t, configGot.Version, ConvertExternalConfig(external).Version)
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{
+			name:   "WithValidConfig",
+			config: Config{LimitCPUToMemoryRatio: 2, CpuRequestToLimitRatio: 0.25, MemoryRequestToLimitRatio: 0.5, CpuRequestToRequestRatio: 0.25},
+		},
+		{
+			name:   "WithEmptyConfig",
+			config: Config{},
+		},
+		{
+			name:    "WithRequestToLimitAboveHundredPercent",
+			config:  Config{MemoryRequestToLimitRatio: 1.5},
+			wantErr: true,
+		},
+		{
+			name:   "WithFailurePolicy",
+			config: Config{FailurePolicy: FailurePolicy{NamespaceLookup: FailOpen, LimitRange: FailOpenForExemptNamespaces, Patch: FailClosed}},
+		},
+		{
+			name:    "WithUnknownFailureAction",
+			config:  Config{FailurePolicy: FailurePolicy{Mutation: "Ignore"}},
+			wantErr: true,
+		},
+		{
+			name:    "WithNegativeRatio",
+			config:  Config{CpuRequestToRequestRatio: -0.5},
+			wantErr: true,
+		},
+		{
+			name:   "WithOverheadHeavyPods",
+			config: Config{OverheadHeavy: &OverheadConfig{ThresholdRatio: 0.25, ClassConfig: ClassConfig{Skip: true}}},
+		},
+		{
+			name:    "WithOverheadHeavyPodsWithoutThreshold",
+			config:  Config{OverheadHeavy: &OverheadConfig{ClassConfig: ClassConfig{Skip: true}}},
+			wantErr: true,
+		},
+		{
+			name:   "WithCPULimitModeNone",
+			config: Config{CPULimitMode: CPULimitModeNone},
+		},
+		{
+			name:    "WithCPULimitBelowRequest",
+			config:  Config{CPULimitMode: CPULimitModeRequestMultiple, CPURequestMultipleRatio: 0.5},
+			wantErr: true,
+		},
+		{
+			name:    "WithRequestMultipleWithoutRatio",
+			config:  Config{CPULimitMode: CPULimitModeRequestMultiple},
+			wantErr: true,
+		},
+		{
+			name:   "WithLimitsFromRequests",
+			config: Config{MemoryLimitToRequestRatio: 1.5, CPULimitToRequestRatio: 2},
+		},
+		{
+			name:   "WithLimitsFromRequestsAndRequestMultiple",
+			config: Config{CPULimitToRequestRatio: 4, CPULimitMode: CPULimitModeRequestMultiple, CPURequestMultipleRatio: 2},
+		},
+		{
+			name:    "WithMemoryLimitBelowRequest",
+			config:  Config{MemoryLimitToRequestRatio: 0.5},
+			wantErr: true,
+		},
+		{
+			name:    "WithUnknownCPULimitMode",
+			config:  Config{CPULimitMode: "Unlimited"},
+			wantErr: true,
+		},
+		{
+			name: "WithRule",
+			config: Config{Rules: []RuleConfig{
+				{Name: "spot", Match: RuleMatch{TolerationKey: "spot"}},
+			}},
+		},
+		{
+			name: "WithRuleWithoutCriterion",
+			config: Config{Rules: []RuleConfig{
+				{Name: "all"},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "WithWorkloadRule",
+			config: Config{Rules: []RuleConfig{
+				{Name: "batch", Match: RuleMatch{OwnerKinds: []string{"Job"}, Priority: &PriorityRange{Max: int32Ptr(0)}}},
+			}},
+		},
+		{
+			name: "WithEmptyPriorityRange",
+			config: Config{Rules: []RuleConfig{
+				{Name: "batch", Match: RuleMatch{Priority: &PriorityRange{}}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "WithInvertedPriorityRange",
+			config: Config{Rules: []RuleConfig{
+				{Name: "batch", Match: RuleMatch{Priority: &PriorityRange{Min: int32Ptr(10), Max: int32Ptr(0)}}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "WithEmptyOwnerKind",
+			config: Config{Rules: []RuleConfig{
+				{Name: "batch", Match: RuleMatch{OwnerKinds: []string{""}}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "WithExpressionRule",
+			config: Config{Rules: []RuleConfig{
+				{Name: "large", Match: RuleMatch{Expression: `size(pod.spec.containers) > 1`}, MemoryRequestToLimitPercentExpression: `25`},
+			}},
+		},
+		{
+			name: "WithInvalidExpression",
+			config: Config{Rules: []RuleConfig{
+				{Name: "large", Match: RuleMatch{Expression: `size(pod.spec.containers)`}},
+			}},
+			wantErr: true,
+		},
+		{
+			name:    "WithNegativeExpressionCostLimit",
+			config:  Config{ExpressionCostLimit: -1},
+			wantErr: true,
+		},
+		{
+			name: "WithDuplicateRuleNames",
+			config: Config{Rules: []RuleConfig{
+				{Name: "spot", Match: RuleMatch{TolerationKey: "spot"}},
+				{Name: "spot", Match: RuleMatch{TolerationKey: "preemptible"}},
+			}},
+			wantErr: true,
+		},
+		{
+			name:   "WithQuotaAction",
+			config: Config{QuotaAction: QuotaActionScale},
+		},
+		{
+			name:    "WithUnknownQuotaAction",
+			config:  Config{QuotaAction: "Ignore"},
+			wantErr: true,
+		},
+		{
+			name:   "WithPreservedQoSClasses",
+			config: Config{QoS: QoSPolicy{Preserve: []corev1.PodQOSClass{corev1.PodQOSGuaranteed, corev1.PodQOSBestEffort}}},
+		},
+		{
+			name:    "WithUnknownPreservedQoSClass",
+			config:  Config{QoS: QoSPolicy{Preserve: []corev1.PodQOSClass{"Exclusive"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errGot := tt.config.Validate()
+
+			if tt.wantErr {
+				assert.Error(t, errGot)
+				return
+			}
+			assert.NoError(t, errGot)
+		})
+	}
+}
+
+func TestConfigValidateWithSeveralUnknownFailureActions(t *testing.T) {
+	config := Config{FailurePolicy: FailurePolicy{NamespaceLookup: "Ignore", LimitRange: "Ignore", Mutation: "Ignore", Patch: "Ignore"}}
+
+	want := config.Validate()
+	require.Error(t, want)
+	for _, name := range []string{"limitRange", "mutation", "namespaceLookup", "patch"} {
+		assert.ErrorContains(t, want, "failurePolicy."+name+" must be one of")
+	}
+
+	for i := 0; i < 10; i++ {
+		assert.EqualError(t, config.Validate(), want.Error())
+	}
+}
+
+func TestConfigValidateReturnsAllErrors(t *testing.T) {
+	config := Config{
+		MemoryRequestToLimitRatio: 1.5,
+		CPULimitMode:              "Unbounded",
+		QuotaAction:               "Ignore",
+	}
+
+	errGot := config.Validate()
+	assert.ErrorContains(t, errGot, "memoryRequestToLimitPercent must be between 0 and 100")
+	assert.ErrorContains(t, errGot, "cpuLimitMode must be one of")
+	assert.ErrorContains(t, errGot, "resourceQuota.action must be one of")
 }
 
 func TestDecodeWithFile(t *testing.T) {
@@ -0,0 +1,72 @@
+package clusterresourceoverride
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ContainerClass is the class of a container, which decides the settings
+// applied to it.
+type ContainerClass string
+
+const (
+	// ContainerClassInit is an init container that runs to completion before
+	// the next one starts.
+	ContainerClassInit ContainerClass = "init"
+
+	// ContainerClassSidecar is a native sidecar, an init container with
+	// restartPolicy Always that runs for the whole lifetime of the pod.
+	ContainerClassSidecar ContainerClass = "sidecar"
+
+	// ContainerClassRegular is a container of the pod.
+	ContainerClassRegular ContainerClass = "regular"
+)
+
+// initContainerClass returns the class of the given init container.
+func initContainerClass(container *corev1.Container) ContainerClass {
+	if isSidecar(container) {
+		return ContainerClassSidecar
+	}
+
+	return ContainerClassInit
+}
+
+// isSidecar returns true if the given init container is a native sidecar.
+func isSidecar(container *corev1.Container) bool {
+	return container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways
+}
+
+// overrideClass overrides the resources of the container with the
+// configuration of its class, and the percents the expressions of the rule
+// compute for it. It returns false if the class is skipped, or if the
+// expressions fail, which sets the error Mutate returns.
+func (m *podMutator) overrideClass(class ContainerClass, container *corev1.Container, pod *corev1.Pod) bool {
+	config, skip := m.config.ForClass(class)
+	if skip {
+		return false
+	}
+
+	if config.expressions != nil {
+		if m.input == nil {
+			m.input = newExpressionInput(pod, m.namespace)
+		}
+
+		var err error
+		if config, err = config.withPercentExpressions(m.input, container); err != nil {
+			if m.err == nil {
+				m.err = fmt.Errorf("rule %s container %s %s", m.config.Rule, container.Name, err.Error())
+			}
+			return false
+		}
+	}
+
+	base := m.config
+	m.config = config
+	defer func() {
+		m.config = base
+	}()
+
+	m.Override(container, pod)
+	return true
+}
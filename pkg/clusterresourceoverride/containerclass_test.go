@@ -0,0 +1,137 @@
+package clusterresourceoverride
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestMutateContainerClasses(t *testing.T) {
+	percent := func(value int64) *int64 { return &value }
+
+	external := &ClusterResourceOverride{
+		Spec: ClusterResourceOverrideSpec{
+			MemoryRequestToLimitPercent: 50,
+			ContainerClasses: &ContainerClasses{
+				Init:    &ContainerClassOverride{Skip: true},
+				Sidecar: &ContainerClassOverride{MemoryRequestToLimitPercent: percent(25)},
+			},
+		},
+	}
+	config := ConvertExternalConfig(external)
+	require.NoError(t, config.Validate())
+
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{
+				newTestContainer("init", "", "", "", "1Gi"),
+				newTestSidecar(newTestContainer("sidecar", "", "", "", "1Gi")),
+			},
+			Containers: []corev1.Container{
+				newTestContainer("app", "", "", "", "1Gi"),
+			},
+		},
+	}
+
+	mutator, err := NewMutator(config, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+	require.NoError(t, err)
+	podGot, err := mutator.Mutate(pod)
+	require.NoError(t, err)
+
+	assert.Empty(t, podGot.Spec.InitContainers[0].Resources.Requests)
+	assert.Equal(t, "256Mi", podGot.Spec.InitContainers[1].Resources.Requests.Memory().String())
+	assert.Equal(t, "512Mi", podGot.Spec.Containers[0].Resources.Requests.Memory().String())
+
+	// skipped containers are not part of the summary.
+	names := []string{}
+	for _, mutation := range mutator.Summary().Containers {
+		names = append(names, mutation.Name)
+	}
+	assert.Equal(t, []string{"sidecar", "app"}, names)
+}
+
+func TestConfigForClass(t *testing.T) {
+	ratio := 0.75
+	config := &Config{
+		CpuRequestToLimitRatio:    0.25,
+		MemoryRequestToLimitRatio: 0.5,
+		Classes: map[ContainerClass]ClassConfig{
+			ContainerClassSidecar: {CpuRequestToLimitRatio: &ratio},
+			ContainerClassInit:    {Skip: true},
+		},
+	}
+
+	configGot, skipGot := config.ForClass(ContainerClassRegular)
+	assert.False(t, skipGot)
+	assert.Same(t, config, configGot)
+
+	configGot, skipGot = config.ForClass(ContainerClassSidecar)
+	assert.False(t, skipGot)
+	assert.Equal(t, 0.75, configGot.CpuRequestToLimitRatio)
+	assert.Equal(t, 0.5, configGot.MemoryRequestToLimitRatio)
+	assert.Equal(t, 0.25, config.CpuRequestToLimitRatio)
+
+	_, skipGot = config.ForClass(ContainerClassInit)
+	assert.True(t, skipGot)
+
+	tooHigh := 1.5
+	config.Classes[ContainerClassRegular] = ClassConfig{MemoryRequestToLimitRatio: &tooHigh}
+	assert.EqualError(t, config.Validate(), "containerClasses.regular.memoryRequestToLimitPercent must be between 0 and 100")
+}
+
+func TestMutateCapInitRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		classes *ContainerClasses
+		want    string
+	}{
+		{
+			name:    "WithCap",
+			classes: &ContainerClasses{CapInitRequests: true},
+			want:    "1Gi",
+		},
+		{
+			name:    "WithoutCap",
+			classes: &ContainerClasses{},
+			want:    "2Gi",
+		},
+		{
+			name:    "WithInitContainersSkipped",
+			classes: &ContainerClasses{CapInitRequests: true, Init: &ContainerClassOverride{Skip: true}},
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := ConvertExternalConfig(&ClusterResourceOverride{
+				Spec: ClusterResourceOverrideSpec{MemoryRequestToLimitPercent: 50, ContainerClasses: tt.classes},
+			})
+
+			init := newTestContainer("init", "", "", "", "1Gi")
+			init.Resources.Limits[corev1.ResourceMemory] = resource.MustParse("4Gi")
+			pod := &corev1.Pod{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{init},
+					Containers:     []corev1.Container{newTestContainer("a", "", "", "", "1Gi"), newTestContainer("b", "", "", "", "1Gi")},
+				},
+			}
+
+			mutator, err := NewMutator(config, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+			require.NoError(t, err)
+			podGot, err := mutator.Mutate(pod)
+			require.NoError(t, err)
+
+			requestGot, found := podGot.Spec.InitContainers[0].Resources.Requests[corev1.ResourceMemory]
+			if tt.want == "" {
+				assert.False(t, found)
+				return
+			}
+			assert.Equal(t, tt.want, requestGot.String())
+			assert.Equal(t, podGot.Spec.InitContainers[0].Resources, mutator.Summary().Containers[0].After)
+		})
+	}
+}
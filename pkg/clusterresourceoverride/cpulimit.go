@@ -0,0 +1,85 @@
+package clusterresourceoverride
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog"
+)
+
+// OverrideCPULimitMode removes the CPU limit, or sets it to a multiple of the
+// CPU request, depending on the CPU limit mode. The CPU request has already
+// been derived from the original limit or the memory limit.
+func (m *podMutator) OverrideCPULimitMode(resources *corev1.ResourceRequirements) {
+	switch m.config.CPULimitMode {
+	case CPULimitModeNone:
+		m.RemoveCPULimit(resources)
+	case CPULimitModeRequestMultiple:
+		m.OverrideCPULimitWithRequest(resources)
+	}
+}
+
+// RemoveCPULimit removes the CPU limit, unless the namespace has a CPU maximum
+// or maxLimitRequestRatio, with which LimitRanger rejects containers without
+// a CPU limit. A container without a CPU request gets its limit as request,
+// which the API server would have defaulted it to.
+func (m *podMutator) RemoveCPULimit(resources *corev1.ResourceRequirements) {
+	limit, found := resources.Limits[corev1.ResourceCPU]
+	if !found {
+		return
+	}
+
+	if ceiling, ratio := m.cpuLimitBounds(); ceiling != nil || ratio != nil {
+		klog.V(3).Infof("cpu limit required by the namespace LimitRanges; keeping limit %q", limit.String())
+		return
+	}
+
+	if _, found := resources.Requests[corev1.ResourceCPU]; !found {
+		ensureRequests(resources)
+		resources.Requests[corev1.ResourceCPU] = limit.DeepCopy()
+	}
+
+	klog.V(5).Infof("removing cpu limit %q", limit.String())
+	delete(resources.Limits, corev1.ResourceCPU)
+}
+
+// OverrideCPULimitWithRequest sets the CPU limit to a multiple of the CPU
+// request, lowered to the maxLimitRequestRatio and the CPU maximum of the
+// namespace.
+func (m *podMutator) OverrideCPULimitWithRequest(resources *corev1.ResourceRequirements) {
+	request, found := resources.Requests[corev1.ResourceCPU]
+	if !found || request.IsZero() {
+		return
+	}
+
+	ratio := m.config.CPURequestMultipleRatio
+	if _, maxRatio := m.cpuLimitBounds(); maxRatio != nil && maxRatio.AsApproximateFloat64() < ratio {
+		klog.V(5).Infof("cpu limit to request ratio %f above namespace maxLimitRequestRatio; setting ratio to %q", ratio, maxRatio.String())
+		ratio = maxRatio.AsApproximateFloat64()
+	}
+
+	amount := float64(request.MilliValue()) * ratio
+	overridden := resource.NewMilliQuantity(int64(amount), resource.DecimalSI)
+	overridden = m.clamp(corev1.ResourceCPU, FieldLimit, overridden)
+
+	ensureLimits(resources)
+	resources.Limits[corev1.ResourceCPU] = *overridden
+
+	// the CPU maximum may have lowered the limit below the request.
+	if request.Cmp(*overridden) > 0 {
+		resources.Requests[corev1.ResourceCPU] = overridden.DeepCopy()
+	}
+}
+
+// cpuLimitBounds returns the CPU maximum and maxLimitRequestRatio that apply
+// to the container being overridden, or to the pod while podLevel is set.
+func (m *podMutator) cpuLimitBounds() (ceiling, ratio *resource.Quantity) {
+	if m.podLevel {
+		return boundQuantity(m.podCeiling, corev1.ResourceCPU), boundQuantity(m.podLimitRequestRatio, corev1.ResourceCPU)
+	}
+
+	if m.IsCpuCeilingSpecified() {
+		ceiling = m.ceiling.CPU
+	}
+
+	return ceiling, boundQuantity(m.limitRequestRatio, corev1.ResourceCPU)
+}
@@ -0,0 +1,113 @@
+package clusterresourceoverride
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestOverrideCPULimitMode(t *testing.T) {
+	quantity := func(value string) *resource.Quantity { q := resource.MustParse(value); return &q }
+
+	tests := []struct {
+		name              string
+		config            *Config
+		ceiling           *CPUMemory
+		limitRequestRatio *CPUMemory
+		resources         corev1.ResourceRequirements
+		wantCPURequest    string
+		wantCPULimit      string
+	}{
+		{
+			name:           "WithLimitRemoved",
+			config:         &Config{CPULimitMode: CPULimitModeNone, CpuRequestToLimitRatio: 0.25},
+			resources:      newTestPod(newTestContainer("app", "", "2", "", "1Gi")).Spec.Containers[0].Resources,
+			wantCPURequest: "500m",
+		},
+		{
+			name:           "WithLimitDerivedFromMemoryRemoved",
+			config:         &Config{CPULimitMode: CPULimitModeNone, LimitCPUToMemoryRatio: 2, CpuRequestToLimitRatio: 0.5},
+			resources:      newTestPod(newTestContainer("app", "", "", "", "1Gi")).Spec.Containers[0].Resources,
+			wantCPURequest: "1",
+		},
+		{
+			name:           "WithoutRequestGetsLimit",
+			config:         &Config{CPULimitMode: CPULimitModeNone},
+			resources:      newTestPod(newTestContainer("app", "", "2", "", "1Gi")).Spec.Containers[0].Resources,
+			wantCPURequest: "2",
+		},
+		{
+			name:           "WithLimitKeptForCeiling",
+			config:         &Config{CPULimitMode: CPULimitModeNone, CpuRequestToLimitRatio: 0.25},
+			ceiling:        &CPUMemory{CPU: quantity("4")},
+			resources:      newTestPod(newTestContainer("app", "", "2", "", "1Gi")).Spec.Containers[0].Resources,
+			wantCPURequest: "500m",
+			wantCPULimit:   "2",
+		},
+		{
+			name:              "WithLimitKeptForMaxLimitRequestRatio",
+			config:            &Config{CPULimitMode: CPULimitModeNone, CpuRequestToLimitRatio: 0.25},
+			limitRequestRatio: &CPUMemory{CPU: quantity("4")},
+			resources:         newTestPod(newTestContainer("app", "", "2", "", "1Gi")).Spec.Containers[0].Resources,
+			wantCPURequest:    "500m",
+			wantCPULimit:      "2",
+		},
+		{
+			name:           "WithRequestMultiple",
+			config:         &Config{CPULimitMode: CPULimitModeRequestMultiple, CPURequestMultipleRatio: 3, CpuRequestToLimitRatio: 0.25},
+			resources:      newTestPod(newTestContainer("app", "", "2", "", "1Gi")).Spec.Containers[0].Resources,
+			wantCPURequest: "500m",
+			wantCPULimit:   "1500m",
+		},
+		{
+			name:              "WithRequestMultipleAboveMaxLimitRequestRatio",
+			config:            &Config{CPULimitMode: CPULimitModeRequestMultiple, CPURequestMultipleRatio: 3},
+			limitRequestRatio: &CPUMemory{CPU: quantity("2")},
+			resources:         newTestPod(newTestContainer("app", "500m", "", "", "1Gi")).Spec.Containers[0].Resources,
+			wantCPURequest:    "500m",
+			wantCPULimit:      "1",
+		},
+		{
+			name:           "WithRequestMultipleAboveCeiling",
+			config:         &Config{CPULimitMode: CPULimitModeRequestMultiple, CPURequestMultipleRatio: 4},
+			ceiling:        &CPUMemory{CPU: quantity("1")},
+			resources:      newTestPod(newTestContainer("app", "500m", "", "", "1Gi")).Spec.Containers[0].Resources,
+			wantCPURequest: "500m",
+			wantCPULimit:   "1",
+		},
+		{
+			name:      "WithRequestMultipleWithoutRequest",
+			config:    &Config{CPULimitMode: CPULimitModeRequestMultiple, CPURequestMultipleRatio: 2},
+			resources: newTestPod(newTestContainer("app", "", "", "", "1Gi")).Spec.Containers[0].Resources,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ceiling := tt.ceiling
+			if ceiling == nil {
+				ceiling = &CPUMemory{}
+			}
+			mutator, err := NewMutator(tt.config, &CPUMemory{}, ceiling, cpuBaseScaleFactor)
+			require.NoError(t, err)
+			mutator.SetLimitRequestRatios(tt.limitRequestRatio, nil)
+
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Resources: tt.resources}}}}
+			podGot, err := mutator.Mutate(pod)
+			require.NoError(t, err)
+
+			resources := podGot.Spec.Containers[0].Resources
+			quantityOf := func(list corev1.ResourceList) string {
+				if quantity, found := list[corev1.ResourceCPU]; found {
+					return quantity.String()
+				}
+				return ""
+			}
+			assert.Equal(t, tt.wantCPURequest, quantityOf(resources.Requests))
+			assert.Equal(t, tt.wantCPULimit, quantityOf(resources.Limits))
+		})
+	}
+}
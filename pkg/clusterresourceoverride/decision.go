@@ -0,0 +1,120 @@
+package clusterresourceoverride
+
+import (
+	"context"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// Decision is a machine readable record of how an admission request was handled.
+type Decision struct {
+	Time          time.Time           `json:"time"`
+	UID           string              `json:"uid"`
+	Namespace     string              `json:"namespace"`
+	Name          string              `json:"name,omitempty"`
+	GenerateName  string              `json:"generateName,omitempty"`
+	User          string              `json:"user"`
+	Operation     string              `json:"operation"`
+	Applicable    bool                `json:"applicable"`
+	Exempt        bool                `json:"exempt"`
+	SelinuxExempt bool                `json:"selinuxExempt"`
+	ConfigVersion string              `json:"configVersion,omitempty"`
+	Rule          string              `json:"rule,omitempty"`
+	Outcome       string              `json:"outcome"`
+	Reason        string              `json:"reason,omitempty"`
+	Error         string              `json:"error,omitempty"`
+	FailedOpen    bool                `json:"failedOpen,omitempty"`
+	Rejected      bool                `json:"rejected,omitempty"`
+	Unchanged     bool                `json:"unchanged,omitempty"`
+	Containers    []ContainerMutation `json:"containers,omitempty"`
+	Pod           *ContainerMutation  `json:"pod,omitempty"`
+	OverheadHeavy bool                `json:"overheadHeavy,omitempty"`
+	QoSChange     string              `json:"qosChange,omitempty"`
+	QoSAction     string              `json:"qosAction,omitempty"`
+	Ephemeral     []string            `json:"ephemeralContainers,omitempty"`
+	Clamps        []Clamp             `json:"clamps,omitempty"`
+	LatencyMillis float64             `json:"latencyMillis"`
+}
+
+// NewDecision returns a Decision for the given request.
+func NewDecision(request *admissionv1.AdmissionRequest) *Decision {
+	return &Decision{
+		Time:      time.Now().UTC(),
+		UID:       string(request.UID),
+		Namespace: request.Namespace,
+		Name:      request.Name,
+		User:      request.UserInfo.Username,
+		Operation: string(request.Operation),
+	}
+}
+
+type decisionKey struct{}
+
+// WithDecision returns a context that carries the given decision, so that the
+// steps of admission can record what they did.
+func WithDecision(ctx context.Context, decision *Decision) context.Context {
+	return context.WithValue(ctx, decisionKey{}, decision)
+}
+
+// DecisionFrom returns the decision carried by ctx, or nil. All methods of
+// Decision can be called on nil.
+func DecisionFrom(ctx context.Context) *Decision {
+	decision, _ := ctx.Value(decisionKey{}).(*Decision)
+	return decision
+}
+
+func (d *Decision) setFailure(reason string, err error) {
+	if d == nil {
+		return
+	}
+
+	d.Reason = reason
+	d.Error = err.Error()
+}
+
+func (d *Decision) setFailedOpen(reason string, err error) {
+	if d == nil {
+		return
+	}
+
+	d.setFailure(reason, err)
+	d.FailedOpen = true
+}
+
+func (d *Decision) setRejected(reason string, err error) {
+	if d == nil {
+		return
+	}
+
+	d.setFailure(reason, err)
+	d.Rejected = true
+}
+
+func (d *Decision) setMutation(config *Config, summary *MutationSummary, unchanged bool) {
+	if d == nil || summary == nil {
+		return
+	}
+
+	d.Unchanged = unchanged
+	d.ConfigVersion = config.Version
+	d.Rule = config.Rule
+	d.Containers = summary.Containers
+	d.Pod = summary.Pod
+	d.OverheadHeavy = summary.OverheadHeavy
+	d.QoSChange = summary.QoSChange()
+	d.QoSAction = summary.QoSAction
+	d.Ephemeral = summary.EphemeralContainers
+	d.Clamps = summary.Clamps()
+}
+
+func (d *Decision) setPod(name, generateName string) {
+	if d == nil {
+		return
+	}
+
+	if name != "" {
+		d.Name = name
+	}
+	d.GenerateName = generateName
+}
@@ -0,0 +1,77 @@
+package clusterresourceoverride
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// EphemeralContainersSubResource is the subresource of pods through which
+	// ephemeral containers are added to running pods.
+	EphemeralContainersSubResource = "ephemeralcontainers"
+)
+
+// MutateEphemeralContainers handles the ephemeral containers added by
+// updating old to in. Ephemeral containers have no resources, and nothing but
+// ephemeral containers can be changed through the subresource, so the pod is
+// left as it is and the added containers are only recorded in the summary.
+func (m *podMutator) MutateEphemeralContainers(old, in *corev1.Pod) (out *corev1.Pod, err error) {
+	m.summary = &MutationSummary{}
+	m.operations = nil
+
+	for _, container := range addedEphemeralContainers(old, in) {
+		m.summary.EphemeralContainers = append(m.summary.EphemeralContainers, container.Name)
+	}
+
+	out = in.DeepCopy()
+	return
+}
+
+// ValidateEphemeralContainers returns an error explaining why the ephemeral
+// containers added by updating old to in are rejected, nil if they are not.
+func (m *podMutator) ValidateEphemeralContainers(old, in *corev1.Pod) error {
+	added := addedEphemeralContainers(old, in)
+	for i := range added {
+		resources := added[i].Resources
+		if len(resources.Requests) > 0 || len(resources.Limits) > 0 {
+			return fmt.Errorf("ephemeral container %s must not set resources", added[i].Name)
+		}
+	}
+
+	if len(added) == 0 || !m.config.RejectEphemeralWithoutHeadroom || in.Spec.Resources == nil {
+		return nil
+	}
+
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		limit, found := in.Spec.Resources.Limits[name]
+		if !found {
+			continue
+		}
+
+		containers := containersQuantity(in, FieldLimit, name)
+		if containers.Cmp(limit) >= 0 {
+			return fmt.Errorf("the containers of the pod may use all of its pod-level %s limit of %s, there is no room for ephemeral containers", name, limit.String())
+		}
+	}
+
+	return nil
+}
+
+// addedEphemeralContainers returns the ephemeral containers of in that old
+// does not have.
+func addedEphemeralContainers(old, in *corev1.Pod) []corev1.EphemeralContainer {
+	existing := map[string]bool{}
+	for i := range old.Spec.EphemeralContainers {
+		existing[old.Spec.EphemeralContainers[i].Name] = true
+	}
+
+	added := []corev1.EphemeralContainer{}
+	for i := range in.Spec.EphemeralContainers {
+		if !existing[in.Spec.EphemeralContainers[i].Name] {
+			added = append(added, in.Spec.EphemeralContainers[i])
+		}
+	}
+
+	return added
+}
@@ -0,0 +1,158 @@
+package clusterresourceoverride
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestAdmissionEphemeralContainersRequestsApplicable(t *testing.T) {
+	admission := clusterResourceOverrideAdmission{}
+	req := &admissionv1.AdmissionRequest{
+		Operation:   admissionv1.Update,
+		Resource:    metav1.GroupVersionResource{Resource: string(corev1.ResourcePods)},
+		SubResource: EphemeralContainersSubResource,
+	}
+	assert.True(t, admission.IsApplicable(req))
+}
+
+func TestValidateEphemeralContainers(t *testing.T) {
+	tests := []struct {
+		name                 string
+		config               *Config
+		containerMemoryLimit string
+		// debugging is true if the pod already runs the debug container.
+		debugging      bool
+		debugResources corev1.ResourceRequirements
+		wantErr        bool
+	}{
+		{
+			name:                 "WithHeadroom",
+			config:               &Config{RejectEphemeralWithoutHeadroom: true},
+			containerMemoryLimit: "1Gi",
+		},
+		{
+			name:                 "WithoutHeadroom",
+			config:               &Config{RejectEphemeralWithoutHeadroom: true},
+			containerMemoryLimit: "2Gi",
+			wantErr:              true,
+		},
+		{
+			name:                 "WithoutHeadroomAllowed",
+			config:               &Config{},
+			containerMemoryLimit: "2Gi",
+		},
+		{
+			name:                 "WithoutHeadroomAndNoNewContainer",
+			config:               &Config{RejectEphemeralWithoutHeadroom: true},
+			containerMemoryLimit: "2Gi",
+			debugging:            true,
+		},
+		{
+			name:                 "WithResources",
+			config:               &Config{},
+			containerMemoryLimit: "1Gi",
+			debugResources:       newTestResources("", "1", "", ""),
+			wantErr:              true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := newTestPod(newTestContainer("app", "", "", "", tt.containerMemoryLimit))
+			podResources := newTestResources("", "", "", "2Gi")
+			old.Spec.Resources = &podResources
+
+			in := old.DeepCopy()
+			in.Spec.EphemeralContainers = []corev1.EphemeralContainer{
+				{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debug", Image: "busybox", Resources: tt.debugResources}},
+			}
+			if tt.debugging {
+				old = in.DeepCopy()
+			}
+
+			mutator, err := NewMutator(tt.config, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+			require.NoError(t, err)
+
+			errGot := mutator.ValidateEphemeralContainers(old, in)
+			if tt.wantErr {
+				assert.Error(t, errGot)
+				return
+			}
+			assert.NoError(t, errGot)
+		})
+	}
+}
+
+func TestAdmitEphemeralContainers(t *testing.T) {
+	querier, _ := newTestLimitQuerier(t, nil)
+	admission := &clusterResourceOverrideAdmission{
+		config:       &Config{MemoryRequestToLimitRatio: 0.5, RejectEphemeralWithoutHeadroom: true},
+		limitQuerier: querier,
+	}
+
+	tests := []struct {
+		name                 string
+		containerMemoryLimit string
+		assert               func(t *testing.T, response *admissionv1.AdmissionResponse, decision *Decision)
+	}{
+		{
+			name:                 "WithHeadroom",
+			containerMemoryLimit: "1Gi",
+			assert: func(t *testing.T, response *admissionv1.AdmissionResponse, decision *Decision) {
+				require.True(t, response.Allowed)
+				assert.Equal(t, "[]", string(response.Patch))
+				assert.Equal(t, "debug", response.AuditAnnotations[AuditEphemeralKey])
+				assert.False(t, decision.Rejected)
+				assert.True(t, decision.Unchanged)
+			},
+		},
+		{
+			name:                 "WithoutHeadroom",
+			containerMemoryLimit: "2Gi",
+			assert: func(t *testing.T, response *admissionv1.AdmissionResponse, decision *Decision) {
+				assert.False(t, response.Allowed)
+				assert.True(t, decision.Rejected)
+				assert.Equal(t, "ephemeral_containers", response.AuditAnnotations[AuditRejectedKey])
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := newTestPod(newTestContainer("app", "", "", "", tt.containerMemoryLimit))
+			podResources := newTestResources("", "", "", "2Gi")
+			old.Spec.Resources = &podResources
+
+			in := old.DeepCopy()
+			in.Spec.EphemeralContainers = []corev1.EphemeralContainer{
+				{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debug", Image: "busybox"}},
+			}
+
+			oldRaw, err := json.Marshal(old)
+			require.NoError(t, err)
+			inRaw, err := json.Marshal(in)
+			require.NoError(t, err)
+
+			request := &admissionv1.AdmissionRequest{
+				Namespace:   "foo",
+				Operation:   admissionv1.Update,
+				Resource:    metav1.GroupVersionResource{Resource: string(corev1.ResourcePods)},
+				SubResource: EphemeralContainersSubResource,
+				Object:      runtime.RawExtension{Raw: inRaw},
+				OldObject:   runtime.RawExtension{Raw: oldRaw},
+			}
+
+			decision := &Decision{}
+			response := admission.Admit(WithDecision(context.TODO(), decision), request)
+			tt.assert(t, response, decision)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package clusterresourceoverride
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+)
+
+const (
+	EventReasonResourcesClamped      = "ResourcesClamped"
+	EventReasonNamespaceLookupFailed = "NamespaceLookupFailed"
+	EventReasonLimitRangeQueryFailed = "LimitRangeQueryFailed"
+	EventReasonFailedOpen            = "AdmittedWithoutOverrides"
+	EventReasonEphemeralRejected     = "EphemeralContainerRejected"
+	EventReasonQuotaExceeded         = "ResourceQuotaExceeded"
+)
+
+// Pods of a busy workload share the object events are recorded on, so events
+// are both rate limited per object and aggregated once similar events repeat.
+const (
+	eventBurstSize            = 10
+	eventQPS                  = 1.0 / 60
+	eventMaxSimilar           = 5
+	eventMaxIntervalInSeconds = 600
+)
+
+func newEventRecorder(client kubernetes.Interface, stopCh <-chan struct{}) record.EventRecorder {
+	broadcaster := record.NewBroadcasterWithCorrelatorOptions(record.CorrelatorOptions{
+		BurstSize:            eventBurstSize,
+		QPS:                  eventQPS,
+		MaxEvents:            eventMaxSimilar,
+		MaxIntervalInSeconds: eventMaxIntervalInSeconds,
+	})
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	go func() {
+		<-stopCh
+		broadcaster.Shutdown()
+	}()
+
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: Name})
+}
+
+// eventTarget returns the object events about the given pod are recorded on.
+// The pod does not exist yet at admission time, so this is its controller if it
+// has one, otherwise the namespace.
+func eventTarget(pod *corev1.Pod, namespace string) *corev1.ObjectReference {
+	if pod != nil {
+		if owner := metav1.GetControllerOf(pod); owner != nil {
+			return &corev1.ObjectReference{
+				APIVersion: owner.APIVersion,
+				Kind:       owner.Kind,
+				Name:       owner.Name,
+				UID:        owner.UID,
+				Namespace:  namespace,
+			}
+		}
+	}
+
+	return &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Namespace",
+		Name:       namespace,
+		Namespace:  namespace,
+	}
+}
+
+// clampEventMessage describes the given clamps. It only depends on which
+// values were clamped so that events for pods of a workload aggregate.
+func clampEventMessage(clamps []Clamp) string {
+	descriptions := map[string]struct{}{}
+	sources := map[string]struct{}{}
+	for _, clamp := range clamps {
+		verb := "raised"
+		if clamp.Bound == BoundCeiling || clamp.Bound == BoundPodCeiling || clamp.Bound == BoundQuota || clamp.Bound == BoundNode {
+			verb = "lowered"
+		}
+
+		switch clamp.Bound {
+		case BoundQuota:
+			sources["namespace ResourceQuota"] = struct{}{}
+		case BoundNode:
+			sources["node allocatable"] = struct{}{}
+		default:
+			sources["namespace LimitRange"] = struct{}{}
+		}
+
+		descriptions[fmt.Sprintf("%s %s %s to %s", clamp.Resource, clamp.Field, verb, clamp.Bound)] = struct{}{}
+	}
+
+	return fmt.Sprintf("Resource overrides of a pod were clamped to the %s: %s", strings.Join(sortedKeys(sources), " and "), strings.Join(sortedKeys(descriptions), ", "))
+}
+
+// nodeCapacityWarning returns a warning for the client if the overrides were
+// capped to the node allocatable, an empty string otherwise.
+func nodeCapacityWarning(clamps []Clamp) string {
+	descriptions := map[string]struct{}{}
+	for _, clamp := range clamps {
+		if clamp.Bound == BoundNode {
+			descriptions[fmt.Sprintf("%s %s lowered to %s", clamp.Resource, clamp.Field, clamp.To)] = struct{}{}
+		}
+	}
+
+	if len(descriptions) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("resource overrides were capped to the largest allocatable of the nodes the pod can be scheduled to: %s", strings.Join(sortedKeys(descriptions), ", "))
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	list := make([]string, 0, len(set))
+	for key := range set {
+		list = append(list, key)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+func (p *clusterResourceOverrideAdmission) recordEvent(target *corev1.ObjectReference, eventType, reason, message string) {
+	if p.recorder == nil {
+		return
+	}
+
+	klog.V(5).Infof("namespace=%s recording %s event on %s/%s - %s", target.Namespace, reason, target.Kind, target.Name, message)
+	p.recorder.Event(target, eventType, reason, message)
+}
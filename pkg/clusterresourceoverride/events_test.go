@@ -0,0 +1,73 @@
+package clusterresourceoverride
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEventTarget(t *testing.T) {
+	controller := true
+
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want *corev1.ObjectReference
+	}{
+		{
+			name: "WithController",
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					OwnerReferences: []metav1.OwnerReference{
+						{
+							APIVersion: "apps/v1",
+							Kind:       "ReplicaSet",
+							Name:       "app-7d4b9c",
+							UID:        "uid",
+							Controller: &controller,
+						},
+					},
+				},
+			},
+			want: &corev1.ObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "ReplicaSet",
+				Name:       "app-7d4b9c",
+				UID:        "uid",
+				Namespace:  "foo",
+			},
+		},
+		{
+			name: "WithoutController",
+			pod:  &corev1.Pod{},
+			want: &corev1.ObjectReference{
+				APIVersion: "v1",
+				Kind:       "Namespace",
+				Name:       "foo",
+				Namespace:  "foo",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, eventTarget(test.pod, "foo"))
+		})
+	}
+}
+
+func TestClampEventMessage(t *testing.T) {
+	clamps := []Clamp{
+		{Resource: corev1.ResourceMemory, Field: FieldRequest, Bound: BoundCeiling, From: "2Gi", To: "1Gi"},
+		{Resource: corev1.ResourceCPU, Field: FieldRequest, Bound: BoundFloor, From: "50m", To: "100m"},
+		{Resource: corev1.ResourceCPU, Field: FieldRequest, Bound: BoundFloor, From: "20m", To: "100m"},
+	}
+
+	// values are left out so that events of pods from the same workload aggregate.
+	assert.Equal(t, "Resource overrides of a pod were clamped to the namespace LimitRange: cpu request raised to floor, memory request lowered to ceiling", clampEventMessage(clamps))
+
+	clamps = append(clamps, Clamp{Resource: corev1.ResourceMemory, Field: FieldLimit, Bound: BoundNode, From: "32Gi", To: "16Gi"})
+	assert.Equal(t, "Resource overrides of a pod were clamped to the namespace LimitRange and node allocatable: cpu request raised to floor, memory limit lowered to node, memory request lowered to ceiling", clampEventMessage(clamps))
+}
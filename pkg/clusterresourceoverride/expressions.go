@@ -0,0 +1,397 @@
+package clusterresourceoverride
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker"
+	"github.com/google/cel-go/common/types/ref"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+	apiservercel "k8s.io/apiserver/pkg/cel"
+	"k8s.io/apiserver/pkg/cel/common"
+	"k8s.io/apiserver/pkg/cel/environment"
+	"k8s.io/apiserver/pkg/cel/library"
+	"k8s.io/apiserver/pkg/cel/openapi"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+)
+
+// Variables the CEL expressions of rules are evaluated on. Match expressions
+// only read the pod and its namespace.
+const (
+	podVariable       = "pod"
+	namespaceVariable = "namespaceObject"
+	containerVariable = "container"
+)
+
+// ruleExpressions are the compiled CEL expressions of a rule, the ones that
+// are not set are nil.
+type ruleExpressions struct {
+	match                       cel.Program
+	cpuRequestToLimitPercent    cel.Program
+	memoryRequestToLimitPercent cel.Program
+}
+
+// expressionVariable is a variable expressions read, typed after the OpenAPI
+// schema of its object.
+type expressionVariable struct {
+	schema   *spec.Schema
+	declType *apiservercel.DeclType
+}
+
+// newExpressionVariable returns the variable holding objects of the type of
+// obj, a resource if root is true.
+func newExpressionVariable(obj interface{}, typeName string, root bool) *expressionVariable {
+	schema := openAPISchemaOf(reflect.TypeOf(obj))
+	return &expressionVariable{
+		schema:   schema,
+		declType: common.SchemaDeclType(&openapi.Schema{Schema: schema}, root).MaybeAssignTypeName(typeName),
+	}
+}
+
+// value returns the object converted to the value of the variable.
+func (v *expressionVariable) value(obj map[string]interface{}) ref.Val {
+	return common.UnstructuredToVal(obj, &openapi.Schema{Schema: v.schema})
+}
+
+// expressionEnvSet holds the environments of match and percent expressions,
+// and the variables they declare.
+type expressionEnvSet struct {
+	match     *cel.Env
+	percent   *cel.Env
+	variables map[string]*expressionVariable
+}
+
+// expressionEnvs returns the environments expressions are compiled in, which
+// are expensive to create and only created once.
+var expressionEnvs = sync.OnceValues(func() (envs expressionEnvSet, err error) {
+	envs.variables = map[string]*expressionVariable{
+		podVariable:       newExpressionVariable(corev1.Pod{}, "io.k8s.api.core.v1.Pod", true),
+		namespaceVariable: newExpressionVariable(corev1.Namespace{}, "io.k8s.api.core.v1.Namespace", true),
+		containerVariable: newExpressionVariable(corev1.Container{}, "io.k8s.api.core.v1.Container", false),
+	}
+
+	if envs.match, err = envs.newEnv(podVariable, namespaceVariable); err != nil {
+		return
+	}
+
+	envs.percent, err = envs.newEnv(podVariable, namespaceVariable, containerVariable)
+	return
+})
+
+// newEnv returns the environment of the Kubernetes CEL libraries, such as
+// quantity(), with the given variables. Fields are checked when expressions
+// are compiled.
+func (envs *expressionEnvSet) newEnv(variables ...string) (*cel.Env, error) {
+	options := make([]cel.EnvOption, 0, len(variables))
+	declTypes := make([]*apiservercel.DeclType, 0, len(variables))
+	for _, name := range variables {
+		variable := envs.variables[name]
+		options = append(options, cel.Variable(name, variable.declType.CelType()))
+		declTypes = append(declTypes, variable.declType)
+	}
+
+	envSet, err := environment.MustBaseEnvSet(environment.DefaultCompatibilityVersion()).Extend(environment.VersionedOptions{
+		IntroducedVersion: environment.DefaultCompatibilityVersion(),
+		EnvOptions:        options,
+		DeclTypes:         declTypes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return envSet.Env(environment.NewExpressions)
+}
+
+// costEstimator returns the estimator of the cost of expressions, which
+// bounds the size of the objects they read by their declared types.
+func (envs *expressionEnvSet) costEstimator() checker.CostEstimator {
+	declTypes := make(map[string]*apiservercel.DeclType, len(envs.variables))
+	for name, variable := range envs.variables {
+		declTypes[name] = variable.declType
+	}
+
+	return &library.CostEstimator{SizeEstimator: &expressionSizeEstimator{variables: declTypes}}
+}
+
+// expressionCostLimit returns the cost limit of each evaluation of an
+// expression.
+func (c *Config) expressionCostLimit() uint64 {
+	if c.ExpressionCostLimit > 0 {
+		return uint64(c.ExpressionCostLimit)
+	}
+
+	return celconfig.PerCallLimit
+}
+
+// hasExpressions returns true if the rule sets any expression.
+func (r *RuleConfig) hasExpressions() bool {
+	return r.Match.Expression != "" || r.CPURequestToLimitPercentExpression != "" || r.MemoryRequestToLimitPercentExpression != ""
+}
+
+// compileExpressions compiles the expressions of the rules, recording the
+// error of the rules whose expressions fail to compile.
+func (c *Config) compileExpressions() {
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		rule.expressions, rule.expressionsErr = compileRuleExpressions(rule, c.expressionCostLimit())
+	}
+}
+
+// expressionsErr returns the error of the first rule whose expressions fail
+// to compile. The expressions of rules that were not converted from a
+// ClusterResourceOverride are compiled to be checked, not recorded.
+func (c *Config) expressionsErr() error {
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		err := rule.expressionsErr
+		if err == nil && rule.expressions == nil {
+			_, err = compileRuleExpressions(rule, c.expressionCostLimit())
+		}
+
+		if err != nil {
+			return fmt.Errorf("rules[%s].%s", rule.Name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// compileRuleExpressions compiles and type checks the expressions of the
+// rule, it returns nil if the rule sets none.
+func compileRuleExpressions(rule *RuleConfig, costLimit uint64) (expressions *ruleExpressions, err error) {
+	if !rule.hasExpressions() {
+		return
+	}
+
+	if rule.Skip && (rule.CPURequestToLimitPercentExpression != "" || rule.MemoryRequestToLimitPercentExpression != "") {
+		err = fmt.Errorf("percent expressions must not be set on a rule that skips pods")
+		return
+	}
+
+	envs, envErr := expressionEnvs()
+	if envErr != nil {
+		err = fmt.Errorf("failed to create the CEL environment - %s", envErr.Error())
+		return
+	}
+
+	expressions = &ruleExpressions{}
+	for _, expression := range []struct {
+		name    string
+		source  string
+		env     *cel.Env
+		types   []*cel.Type
+		program *cel.Program
+	}{
+		{name: "match.expression", source: rule.Match.Expression, env: envs.match, types: []*cel.Type{cel.BoolType}, program: &expressions.match},
+		{name: "cpuRequestToLimitPercentExpression", source: rule.CPURequestToLimitPercentExpression, env: envs.percent, types: []*cel.Type{cel.IntType, cel.UintType, cel.DoubleType}, program: &expressions.cpuRequestToLimitPercent},
+		{name: "memoryRequestToLimitPercentExpression", source: rule.MemoryRequestToLimitPercentExpression, env: envs.percent, types: []*cel.Type{cel.IntType, cel.UintType, cel.DoubleType}, program: &expressions.memoryRequestToLimitPercent},
+	} {
+		if expression.source == "" {
+			continue
+		}
+
+		program, compileErr := compileExpression(expression.env, envs.costEstimator(), expression.source, costLimit, expression.types...)
+		if compileErr != nil {
+			expressions = nil
+			err = fmt.Errorf("%s %s", expression.name, compileErr.Error())
+			return
+		}
+		*expression.program = program
+	}
+
+	return
+}
+
+// compileExpression compiles the expression, which must evaluate to one of
+// the given types or to a value whose type is only known once evaluated, and
+// whose estimated cost must be within the cost limit.
+func compileExpression(env *cel.Env, estimator checker.CostEstimator, expression string, costLimit uint64, types ...*cel.Type) (cel.Program, error) {
+	ast, issues := env.Compile(expression)
+	if issues.Err() != nil {
+		return nil, fmt.Errorf("failed to compile - %s", issues.Err().Error())
+	}
+
+	output := ast.OutputType()
+	if !output.IsExactType(cel.DynType) && !slices.ContainsFunc(types, output.IsExactType) {
+		return nil, fmt.Errorf("must evaluate to %v, not %s", types, output)
+	}
+
+	cost, err := env.EstimateCost(ast, estimator)
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate cost - %s", err.Error())
+	}
+	if cost.Max > costLimit {
+		return nil, fmt.Errorf("estimated cost %d exceeds the cost limit %d", cost.Max, costLimit)
+	}
+
+	program, err := env.Program(ast, cel.CostLimit(costLimit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create program - %s", err.Error())
+	}
+
+	return program, nil
+}
+
+// expressionInput holds the objects expressions are evaluated on, converted
+// to the values of their variables at most once.
+type expressionInput struct {
+	pod       *corev1.Pod
+	namespace *corev1.Namespace
+	variables map[string]interface{}
+}
+
+func newExpressionInput(pod *corev1.Pod, namespace *corev1.Namespace) *expressionInput {
+	return &expressionInput{
+		pod:       pod,
+		namespace: namespace,
+	}
+}
+
+// podVariables returns the variables of match expressions.
+func (in *expressionInput) podVariables() (map[string]interface{}, error) {
+	if in.variables != nil {
+		return in.variables, nil
+	}
+
+	pod, err := toUnstructured(in.pod)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert pod - %s", err.Error())
+	}
+
+	namespace, err := toUnstructured(in.namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert namespace - %s", err.Error())
+	}
+
+	envs, err := expressionEnvs()
+	if err != nil {
+		return nil, err
+	}
+
+	in.variables = map[string]interface{}{
+		podVariable:       envs.variables[podVariable].value(pod),
+		namespaceVariable: envs.variables[namespaceVariable].value(namespace),
+	}
+	return in.variables, nil
+}
+
+// containerVariables returns the variables of percent expressions evaluated
+// for the given container.
+func (in *expressionInput) containerVariables(container *corev1.Container) (map[string]interface{}, error) {
+	podVariables, err := in.podVariables()
+	if err != nil {
+		return nil, err
+	}
+
+	converted, err := toUnstructured(container)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert container - %s", err.Error())
+	}
+
+	envs, err := expressionEnvs()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		podVariable:       podVariables[podVariable],
+		namespaceVariable: podVariables[namespaceVariable],
+		containerVariable: envs.variables[containerVariable].value(converted),
+	}, nil
+}
+
+// toUnstructured converts the object to a map, an empty map if it is nil.
+func toUnstructured[T any](obj *T) (map[string]interface{}, error) {
+	if obj == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+}
+
+// matches evaluates the match expression of the rule.
+func (e *ruleExpressions) matches(input *expressionInput) (bool, error) {
+	variables, err := input.podVariables()
+	if err != nil {
+		return false, err
+	}
+
+	out, _, err := e.match.Eval(variables)
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate match.expression - %s", err.Error())
+	}
+
+	matched, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("match.expression evaluated to %v, not a bool", out.Value())
+	}
+
+	return matched, nil
+}
+
+// withPercentExpressions returns the configuration with the percents the
+// expressions compute for the given container.
+func (c *Config) withPercentExpressions(input *expressionInput, container *corev1.Container) (*Config, error) {
+	e := c.expressions
+	if e == nil || (e.cpuRequestToLimitPercent == nil && e.memoryRequestToLimitPercent == nil) {
+		return c, nil
+	}
+
+	variables, err := input.containerVariables(container)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := *c
+	for _, expression := range []struct {
+		name    string
+		program cel.Program
+		ratio   *float64
+	}{
+		{name: "cpuRequestToLimitPercentExpression", program: e.cpuRequestToLimitPercent, ratio: &merged.CpuRequestToLimitRatio},
+		{name: "memoryRequestToLimitPercentExpression", program: e.memoryRequestToLimitPercent, ratio: &merged.MemoryRequestToLimitRatio},
+	} {
+		if expression.program == nil {
+			continue
+		}
+
+		percent, err := evaluatePercent(expression.program, variables)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s", expression.name, err.Error())
+		}
+		*expression.ratio = percent / 100
+	}
+
+	return &merged, nil
+}
+
+// evaluatePercent evaluates the program to a percent between 0 and 100.
+func evaluatePercent(program cel.Program, variables map[string]interface{}) (float64, error) {
+	out, _, err := program.Eval(variables)
+	if err != nil {
+		return 0, fmt.Errorf("failed to evaluate - %s", err.Error())
+	}
+
+	var percent float64
+	switch value := out.Value().(type) {
+	case int64:
+		percent = float64(value)
+	case uint64:
+		percent = float64(value)
+	case float64:
+		percent = value
+	default:
+		return 0, fmt.Errorf("evaluated to %v, not a number", out.Value())
+	}
+
+	if percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("evaluated to %v, not a percent between 0 and 100", percent)
+	}
+
+	return percent, nil
+}
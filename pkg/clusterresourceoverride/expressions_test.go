@@ -0,0 +1,290 @@
+package clusterresourceoverride
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+)
+
+func TestCompileRuleExpressions(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    RuleConfig
+		wantErr bool
+	}{
+		{
+			name: "WithoutExpressions",
+			rule: RuleConfig{Match: RuleMatch{TolerationKey: "spot"}},
+		},
+		{
+			name: "WithMatchExpression",
+			rule: RuleConfig{Match: RuleMatch{Expression: `quantity(pod.spec.containers[0].resources.limits.memory).isGreaterThan(quantity("2Gi"))`}},
+		},
+		{
+			name: "WithMatchExpressionOnNamespace",
+			rule: RuleConfig{Match: RuleMatch{Expression: `namespaceObject.metadata.labels["tier"] == "batch"`}},
+		},
+		{
+			name:    "WithMatchExpressionOnContainer",
+			rule:    RuleConfig{Match: RuleMatch{Expression: `container.name == "app"`}},
+			wantErr: true,
+		},
+		{
+			name:    "WithMatchExpressionOnMisspelledField",
+			rule:    RuleConfig{Match: RuleMatch{Expression: `size(pod.spec.contaners) > 1`}},
+			wantErr: true,
+		},
+		{
+			name:    "WithMatchExpressionOverCostLimit",
+			rule:    RuleConfig{Match: RuleMatch{Expression: `pod.spec.containers.all(c, quantity(c.resources.limits.memory).isGreaterThan(quantity("2Gi")))`}},
+			wantErr: true,
+		},
+		{
+			name:    "WithMatchExpressionOfString",
+			rule:    RuleConfig{Match: RuleMatch{Expression: `"true"`}},
+			wantErr: true,
+		},
+		{
+			name:    "WithInvalidSyntax",
+			rule:    RuleConfig{Match: RuleMatch{Expression: `pod.spec.containers.exists(c,`}},
+			wantErr: true,
+		},
+		{
+			name: "WithPercentExpressions",
+			rule: RuleConfig{
+				CPURequestToLimitPercentExpression:    `container.name == "app" ? 10 : 50`,
+				MemoryRequestToLimitPercentExpression: `100.0 / double(size(pod.spec.containers))`,
+			},
+		},
+		{
+			name:    "WithPercentExpressionOfBool",
+			rule:    RuleConfig{CPURequestToLimitPercentExpression: `size(pod.spec.containers) > 1`},
+			wantErr: true,
+		},
+		{
+			name: "WithPercentExpressionOnSkippingRule",
+			rule: RuleConfig{
+				ClassConfig:                        ClassConfig{Skip: true},
+				CPURequestToLimitPercentExpression: `10`,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expressionsGot, err := compileRuleExpressions(&tt.rule, celconfig.PerCallLimit)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, expressionsGot)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.rule.hasExpressions(), expressionsGot != nil)
+		})
+	}
+}
+
+func TestConfigForPodWithExpression(t *testing.T) {
+	config := ConvertExternalConfig(&ClusterResourceOverride{Spec: ClusterResourceOverrideSpec{
+		MemoryRequestToLimitPercent: 50,
+		Rules: []Rule{
+			{
+				Name: "large",
+				Match: RuleMatch{
+					Expression: `namespaceObject.metadata.labels["tier"] == "batch" && quantity(pod.spec.containers[0].resources.limits.memory).isGreaterThan(quantity("2Gi"))`,
+				},
+				ContainerClassOverride: ContainerClassOverride{Skip: true},
+			},
+		},
+	}})
+	require.NoError(t, config.Validate())
+
+	batch := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "foo", Labels: map[string]string{"tier": "batch"}}}
+
+	tests := []struct {
+		name      string
+		pod       *corev1.Pod
+		namespace *corev1.Namespace
+		wantRule  string
+		wantErr   bool
+	}{
+		{
+			name:      "WithLargeLimit",
+			pod:       newTestPod(newTestContainer("app", "", "", "", "4Gi")),
+			namespace: batch,
+			wantRule:  "large",
+		},
+		{
+			name:      "WithSmallLimit",
+			pod:       newTestPod(newTestContainer("app", "", "", "", "1Gi")),
+			namespace: batch,
+		},
+		{
+			name:    "WithoutNamespace",
+			pod:     newTestPod(newTestContainer("app", "", "", "", "4Gi")),
+			wantErr: true,
+		},
+		{
+			name:      "WithoutLimit",
+			pod:       newTestPod(newTestContainer("app", "", "", "1Gi", "")),
+			namespace: batch,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configGot, err := config.ForPod(tt.pod, &RuleInput{Namespace: tt.namespace})
+			if tt.wantErr {
+				assert.Error(t, err, "fields that are not set fail the match")
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantRule, configGot.Rule)
+		})
+	}
+}
+
+func TestConfigForPodWithoutCompiledExpression(t *testing.T) {
+	config := &Config{Rules: []RuleConfig{
+		{Name: "large", Match: RuleMatch{Expression: `true`}},
+	}}
+	require.NoError(t, config.Validate())
+
+	_, err := config.ForPod(&corev1.Pod{}, nil)
+	assert.Error(t, err, "Validate must not compile the expressions")
+}
+
+func TestConvertExternalConfigCompilesExpressions(t *testing.T) {
+	config := ConvertExternalConfig(&ClusterResourceOverride{Spec: ClusterResourceOverrideSpec{
+		Rules: []Rule{
+			{Name: "all", Match: RuleMatch{Expression: `true`}},
+		},
+	}})
+
+	configGot, err := config.ForPod(&corev1.Pod{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "all", configGot.Rule)
+
+	config = ConvertExternalConfig(&ClusterResourceOverride{Spec: ClusterResourceOverrideSpec{
+		Rules: []Rule{
+			{Name: "invalid", Match: RuleMatch{Expression: `pod.spec.containers.exists(c,`}},
+		},
+	}})
+	assert.ErrorContains(t, config.Validate(), "rules[invalid].match.expression")
+
+	_, err = config.ForPod(&corev1.Pod{}, nil)
+	assert.ErrorContains(t, err, "rules[invalid].match.expression")
+}
+
+func TestMutateWithPercentExpressions(t *testing.T) {
+	tests := []struct {
+		name           string
+		expression     string
+		costLimit      int64
+		pod            *corev1.Pod
+		want           map[string]string
+		wantErr        string
+		wantCompileErr string
+	}{
+		{
+			name:       "WithSingleContainer",
+			expression: `size(pod.spec.containers) > 1 ? 25 : 50`,
+			pod:        newTestPod(newTestContainer("app", "", "", "", "1Gi")),
+			want:       map[string]string{"app": "512Mi"},
+		},
+		{
+			name:       "WithSeveralContainers",
+			expression: `container.name == "sidecar" ? 25.0 : 100.0 / double(size(pod.spec.containers))`,
+			pod: func() *corev1.Pod {
+				pod := newTestPod(newTestContainer("app", "", "", "", "1Gi"))
+				sidecar := *pod.Spec.Containers[0].DeepCopy()
+				sidecar.Name = "sidecar"
+				pod.Spec.Containers = append(pod.Spec.Containers, sidecar)
+				return pod
+			}(),
+			want: map[string]string{"app": "512Mi", "sidecar": "256Mi"},
+		},
+		{
+			name:       "WithNamespaceLabel",
+			expression: `namespaceObject.metadata.labels["tier"] == "batch" ? 10 : 50`,
+			pod:        newTestPod(newTestContainer("app", "", "", "", "1000Mi")),
+			want:       map[string]string{"app": "100Mi"},
+		},
+		{
+			name:       "WithoutLabel",
+			expression: `pod.metadata.labels["size"] == "large" ? 25 : 50`,
+			pod:        newTestPod(newTestContainer("app", "", "", "", "1Gi")),
+			wantErr:    "no such key",
+		},
+		{
+			name:       "WithoutLabelGuarded",
+			expression: `pod.metadata.?labels[?"size"].orValue("") == "large" ? 25 : 50`,
+			pod:        newTestPod(newTestContainer("app", "", "", "", "1Gi")),
+			want:       map[string]string{"app": "512Mi"},
+		},
+		{
+			name:       "WithPercentOutOfRange",
+			expression: `150`,
+			pod:        newTestPod(newTestContainer("app", "", "", "", "1Gi")),
+			wantErr:    "not a percent",
+		},
+		{
+			name:           "WithCostOverLimit",
+			expression:     `pod.spec.containers.map(c, c.name).size() * 10`,
+			costLimit:      1,
+			pod:            newTestPod(newTestContainer("app", "", "", "", "1Gi")),
+			wantCompileErr: "cost limit",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := ConvertExternalConfig(&ClusterResourceOverride{Spec: ClusterResourceOverrideSpec{
+				MemoryRequestToLimitPercent: 100,
+				ExpressionCostLimit:         tt.costLimit,
+				Rules: []Rule{
+					{
+						Name:                                  "computed",
+						Match:                                 RuleMatch{Expression: `true`},
+						MemoryRequestToLimitPercentExpression: tt.expression,
+					},
+				},
+			}})
+			if tt.wantCompileErr != "" {
+				assert.ErrorContains(t, config.Validate(), tt.wantCompileErr)
+				return
+			}
+			require.NoError(t, config.Validate())
+
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "foo", Labels: map[string]string{"tier": "batch"}}}
+			configGot, err := config.ForPod(tt.pod, &RuleInput{Namespace: namespace})
+			require.NoError(t, err)
+
+			mutator, err := NewMutator(configGot, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+			require.NoError(t, err)
+			mutator.SetNamespace(namespace)
+
+			podGot, err := mutator.Mutate(tt.pod)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			for _, container := range podGot.Spec.Containers {
+				want := resource.MustParse(tt.want[container.Name])
+				requestGot := container.Resources.Requests[corev1.ResourceMemory]
+				assert.Truef(t, want.Equal(requestGot), "container %s memory request %s, want %s", container.Name, requestGot.String(), want.String())
+			}
+		})
+	}
+}
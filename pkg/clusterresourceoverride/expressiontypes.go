@@ -0,0 +1,166 @@
+package clusterresourceoverride
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/google/cel-go/checker"
+	apiservercel "k8s.io/apiserver/pkg/cel"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+)
+
+// openAPISchemaTyper is implemented by API types serialized as a scalar, such
+// as resource.Quantity or metav1.Time.
+type openAPISchemaTyper interface {
+	OpenAPISchemaType() []string
+	OpenAPISchemaFormat() string
+}
+
+var openAPISchemaTyperType = reflect.TypeOf((*openAPISchemaTyper)(nil)).Elem()
+
+// openAPISchemaOf returns the OpenAPI schema of the given API type, built the
+// way the schemas the API server publishes are generated: properties are named
+// after the json tags of the fields, the fields that are not omitted when
+// empty are required, and the types serialized as a scalar declare their type
+// and format.
+func openAPISchemaOf(t reflect.Type) *spec.Schema {
+	return openAPISchemaOfType(t, map[reflect.Type]bool{})
+}
+
+func openAPISchemaOfType(t reflect.Type, visiting map[reflect.Type]bool) *spec.Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if reflect.PointerTo(t).Implements(openAPISchemaTyperType) {
+		typer := reflect.New(t).Interface().(openAPISchemaTyper)
+		schema := &spec.Schema{SchemaProps: spec.SchemaProps{Type: typer.OpenAPISchemaType(), Format: typer.OpenAPISchemaFormat()}}
+		if schema.Format == "int-or-string" {
+			schema.Type = nil
+			schema.Extensions = spec.Extensions{"x-kubernetes-int-or-string": true}
+		}
+		return schema
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return spec.StringProperty()
+	case reflect.Bool:
+		return spec.BooleanProperty()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return spec.Int64Property()
+	case reflect.Float32, reflect.Float64:
+		return spec.Float64Property()
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &spec.Schema{SchemaProps: spec.SchemaProps{Type: spec.StringOrArray{"string"}, Format: "byte"}}
+		}
+
+		items := openAPISchemaOfType(t.Elem(), visiting)
+		if items == nil {
+			return nil
+		}
+		return spec.ArrayProperty(items)
+	case reflect.Map:
+		values := openAPISchemaOfType(t.Elem(), visiting)
+		if values == nil {
+			return nil
+		}
+		return spec.MapProperty(values)
+	case reflect.Struct:
+		// recursive types are not exposed past their first occurrence.
+		if visiting[t] {
+			return nil
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		schema := &spec.Schema{SchemaProps: spec.SchemaProps{Type: spec.StringOrArray{"object"}, Properties: map[string]spec.Schema{}}}
+		addOpenAPIProperties(schema, t, visiting)
+		return schema
+	}
+
+	return nil
+}
+
+// addOpenAPIProperties adds the fields of the given struct, and of the structs
+// it inlines, to the properties of the schema.
+func addOpenAPIProperties(schema *spec.Schema, t reflect.Type, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if strings.Contains(options, "inline") || (field.Anonymous && name == "") {
+			addOpenAPIProperties(schema, field.Type, visiting)
+			continue
+		}
+
+		if name == "" {
+			continue
+		}
+
+		property := openAPISchemaOfType(field.Type, visiting)
+		if property == nil {
+			continue
+		}
+
+		schema.Properties[name] = *property
+		if !strings.Contains(options, "omitempty") && !strings.Contains(options, "omitzero") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// expressionSizeEstimator estimates the size of the values expressions read
+// from the declared types of the variables, which bound the number of items
+// of lists and maps by the size of a request.
+type expressionSizeEstimator struct {
+	variables map[string]*apiservercel.DeclType
+}
+
+func (e *expressionSizeEstimator) EstimateSize(element checker.AstNode) *checker.SizeEstimate {
+	path := element.Path()
+	if len(path) == 0 {
+		return nil
+	}
+
+	declType, found := e.variables[path[0]]
+	for _, segment := range path[1:] {
+		if !found || declType == nil {
+			return nil
+		}
+
+		switch {
+		case segment == "@items" && declType.IsList(), segment == "@values" && declType.IsMap():
+			declType = declType.ElemType
+		case segment == "@keys" && declType.IsMap():
+			declType = declType.KeyType
+		case declType.IsMap():
+			// a key selected as a field, such as limits.memory.
+			declType = declType.ElemType
+		default:
+			var field *apiservercel.DeclField
+			field, found = declType.FindField(segment)
+			if found {
+				declType = field.Type
+			}
+		}
+	}
+
+	if !found || declType == nil || declType.MaxElements == 0 {
+		return nil
+	}
+
+	return &checker.SizeEstimate{Min: 0, Max: uint64(declType.MaxElements)}
+}
+
+func (e *expressionSizeEstimator) EstimateCallCost(function, overloadID string, target *checker.AstNode, args []checker.AstNode) *checker.CallEstimate {
+	return nil
+}
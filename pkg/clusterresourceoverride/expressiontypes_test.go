@@ -0,0 +1,32 @@
+package clusterresourceoverride
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestOpenAPISchemaOf(t *testing.T) {
+	pod := openAPISchemaOf(reflect.TypeOf(corev1.Pod{}))
+	require.NotNil(t, pod)
+	assert.Contains(t, pod.Properties, "apiVersion", "the fields of TypeMeta must be inlined")
+
+	metadata := pod.Properties["metadata"]
+	assert.Equal(t, "date-time", metadata.Properties["creationTimestamp"].Format)
+	assert.True(t, metadata.Properties["labels"].Type.Contains("object"))
+
+	container := pod.Properties["spec"].Properties["containers"].Items.Schema
+	require.NotNil(t, container)
+	assert.Contains(t, container.Required, "name")
+	assert.NotContains(t, container.Required, "image")
+
+	limits := container.Properties["resources"].Properties["limits"]
+	require.NotNil(t, limits.AdditionalProperties)
+	assert.True(t, limits.AdditionalProperties.Schema.Type.Contains("string"), "quantities must be strings")
+
+	port := container.Properties["livenessProbe"].Properties["httpGet"].Properties["port"]
+	assert.Equal(t, true, port.Extensions["x-kubernetes-int-or-string"])
+}
@@ -0,0 +1,66 @@
+package clusterresourceoverride
+
+import (
+	"context"
+	"fmt"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+
+	"github.com/openshift/cluster-resource-override-admission/pkg/metrics"
+	admissionresponse "github.com/openshift/cluster-resource-override-admission/pkg/response"
+)
+
+// actionFor returns the action to take for an error of the given class,
+// which is one of the error reasons of the metrics package.
+func (f FailurePolicy) actionFor(reason string) FailureAction {
+	var action FailureAction
+	switch reason {
+	case metrics.ReasonNamespaceLookup:
+		action = f.NamespaceLookup
+	case metrics.ReasonLimitRange:
+		action = f.LimitRange
+	case metrics.ReasonMutation:
+		action = f.Mutation
+	case metrics.ReasonPatch:
+		action = f.Patch
+	}
+
+	if action == "" {
+		action = FailClosed
+	}
+	return action
+}
+
+// failsOpen returns true if a pod in the given namespace is admitted
+// unmodified after an error of the given class.
+func (f FailurePolicy) failsOpen(reason, namespace string) bool {
+	switch f.actionFor(reason) {
+	case FailOpen:
+		return true
+	case FailOpenForExemptNamespaces:
+		return IsNamespaceExempt(namespace)
+	default:
+		return false
+	}
+}
+
+// failOpen returns a response admitting the pod unmodified if the failure
+// policy says so for the given class of error, nil if the pod must be denied.
+// pod is nil if the error occurred before the pod was decoded.
+func (p *clusterResourceOverrideAdmission) failOpen(ctx context.Context, request *admissionv1.AdmissionRequest, pod *corev1.Pod, reason string, err error) *admissionv1.AdmissionResponse {
+	if !p.config.FailurePolicy.failsOpen(reason, request.Namespace) {
+		return nil
+	}
+
+	klog.Warningf("namespace=%s admitting pod without overrides after %s failure - %v", request.Namespace, reason, err)
+	metrics.RecordRequest(request.Namespace, metrics.OutcomeFailedOpen, reason)
+	DecisionFrom(ctx).setFailedOpen(reason, err)
+	p.recordEvent(eventTarget(pod, request.Namespace), corev1.EventTypeWarning, EventReasonFailedOpen,
+		fmt.Sprintf("Pod was admitted without resource overrides after a %s failure: %v", reason, err))
+
+	response := admissionresponse.WithWarning(admissionresponse.WithAllowed(request),
+		fmt.Sprintf("%s: resource overrides were not applied: %v", Name, err))
+	return admissionresponse.WithAuditAnnotation(response, AuditFailedOpenKey, reason)
+}
@@ -0,0 +1,77 @@
+package clusterresourceoverride
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/openshift/cluster-resource-override-admission/pkg/metrics"
+)
+
+func TestFailurePolicyFailsOpen(t *testing.T) {
+	policy := FailurePolicy{
+		NamespaceLookup: FailOpen,
+		LimitRange:      FailOpenForExemptNamespaces,
+		Mutation:        FailClosed,
+	}
+
+	tests := []struct {
+		name      string
+		reason    string
+		namespace string
+		want      bool
+	}{
+		{name: "FailOpen", reason: metrics.ReasonNamespaceLookup, namespace: "foo", want: true},
+		{name: "FailOpenForExemptNamespace", reason: metrics.ReasonLimitRange, namespace: "openshift-monitoring", want: true},
+		{name: "FailOpenForExemptNamespacesWithRegularNamespace", reason: metrics.ReasonLimitRange, namespace: "foo", want: false},
+		{name: "FailClosed", reason: metrics.ReasonMutation, namespace: "kube-system", want: false},
+		{name: "Default", reason: metrics.ReasonPatch, namespace: "kube-system", want: false},
+		{name: "BadRequestAlwaysFailsClosed", reason: metrics.ReasonBadRequest, namespace: "kube-system", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, policy.failsOpen(tt.reason, tt.namespace))
+		})
+	}
+}
+
+func TestFailOpen(t *testing.T) {
+	request := &admissionv1.AdmissionRequest{UID: "1234", Namespace: "foo"}
+	lookupErr := errors.New("namespace not found")
+
+	t.Run("WithFailClosed", func(t *testing.T) {
+		admission := &clusterResourceOverrideAdmission{config: &Config{}}
+
+		assert.Nil(t, admission.failOpen(context.TODO(), request, nil, metrics.ReasonNamespaceLookup, lookupErr))
+	})
+
+	t.Run("WithFailOpen", func(t *testing.T) {
+		recorder := record.NewFakeRecorder(1)
+		admission := &clusterResourceOverrideAdmission{
+			config:   &Config{FailurePolicy: FailurePolicy{NamespaceLookup: FailOpen}},
+			recorder: recorder,
+		}
+		decision := NewDecision(request)
+
+		response := admission.failOpen(WithDecision(context.TODO(), decision), request, nil, metrics.ReasonNamespaceLookup, lookupErr)
+		require.NotNil(t, response)
+		assert.True(t, response.Allowed)
+		assert.Nil(t, response.Patch)
+		require.Len(t, response.Warnings, 1)
+		assert.Contains(t, response.Warnings[0], lookupErr.Error())
+		assert.Equal(t, metrics.ReasonNamespaceLookup, response.AuditAnnotations[AuditFailedOpenKey])
+
+		assert.True(t, decision.FailedOpen)
+		assert.Equal(t, metrics.ReasonNamespaceLookup, decision.Reason)
+
+		require.Len(t, recorder.Events, 1)
+		assert.Contains(t, <-recorder.Events, corev1.EventTypeWarning+" "+EventReasonFailedOpen)
+	})
+}
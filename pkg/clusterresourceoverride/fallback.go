@@ -0,0 +1,213 @@
+package clusterresourceoverride
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+
+	"github.com/openshift/cluster-resource-override-admission/pkg/metrics"
+)
+
+// The informer caches lag behind the API server. Namespaces created moments
+// before a pod, and labels or LimitRanges added right after the namespace was
+// created, may not have been observed yet. Lookups for such namespaces fall
+// back to the API server.
+const (
+	// liveLookupTimeout bounds how long a live lookup may take.
+	liveLookupTimeout = 2 * time.Second
+
+	// recentNamespaceWindow is how long after its creation a namespace is
+	// read from the API server rather than trusting the cache.
+	recentNamespaceWindow = time.Minute
+
+	// negativeCacheTTL is how long the result of a live lookup that found
+	// nothing is remembered, so that a burst of pods does not translate into
+	// a burst of requests to the API server.
+	negativeCacheTTL = 5 * time.Second
+
+	// positiveCacheTTL is how long a namespace read from the API server is
+	// reused. It is kept short since labels added to the namespace are only
+	// seen once it expires, unless the informer observes them first.
+	positiveCacheTTL = 2 * time.Second
+
+	negativeCacheSize = 1024
+)
+
+// namespaceGetter gets namespaces from the informer cache, falling back to the
+// API server on a cache miss or if the namespace was created recently.
+type namespaceGetter struct {
+	lister   corev1listers.NamespaceLister
+	client   kubernetes.Interface
+	notFound *utilcache.LRUExpireCache
+	found    *utilcache.LRUExpireCache
+	now      func() time.Time
+}
+
+func newNamespaceGetter(lister corev1listers.NamespaceLister, client kubernetes.Interface) *namespaceGetter {
+	return &namespaceGetter{
+		lister:   lister,
+		client:   client,
+		notFound: utilcache.NewLRUExpireCache(negativeCacheSize),
+		found:    utilcache.NewLRUExpireCache(negativeCacheSize),
+		now:      time.Now,
+	}
+}
+
+func (g *namespaceGetter) Get(ctx context.Context, name string) (*corev1.Namespace, error) {
+	cached, err := g.lister.Get(name)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	if cached != nil && (!g.isRecent(cached) || isFullyEnabled(cached)) {
+		return cached, nil
+	}
+
+	if cached == nil {
+		if _, found := g.notFound.Get(name); found {
+			metrics.RecordLiveLookup("namespaces", metrics.LookupNegativeCacheHit)
+			return nil, err
+		}
+	}
+
+	if live, found := g.found.Get(name); found {
+		metrics.RecordLiveLookup("namespaces", metrics.LookupPositiveCacheHit)
+		return live.(*corev1.Namespace), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, liveLookupTimeout)
+	defer cancel()
+
+	live, liveErr := g.client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case liveErr == nil:
+		metrics.RecordLiveLookup("namespaces", metrics.LookupFound)
+		g.found.Add(name, live, positiveCacheTTL)
+		return live, nil
+	case k8serrors.IsNotFound(liveErr):
+		metrics.RecordLiveLookup("namespaces", metrics.LookupNotFound)
+		g.notFound.Add(name, struct{}{}, negativeCacheTTL)
+		return nil, liveErr
+	default:
+		metrics.RecordLiveLookup("namespaces", metrics.LookupError)
+	}
+
+	if cached != nil {
+		klog.V(3).Infof("namespace=%s live lookup failed, using cached namespace - %v", name, liveErr)
+		return cached, nil
+	}
+
+	return nil, liveErr
+}
+
+// isRecent returns true if the namespace was created so recently that the
+// cache may not have observed changes made to it since.
+func (g *namespaceGetter) isRecent(ns *corev1.Namespace) bool {
+	return g.now().Sub(ns.CreationTimestamp.Time) < recentNamespaceWindow
+}
+
+// forget drops the negative cache entry of the given namespace, it is called
+// once the informer observes the namespace.
+func (g *namespaceGetter) forget(name string) {
+	g.notFound.Remove(name)
+}
+
+func isFullyEnabled(ns *corev1.Namespace) bool {
+	return ns.Labels[EnabledLabelName] == "true" && ns.Labels[SelinuxFixEnabledLabelName] == "true"
+}
+
+// limitRangeLister lists LimitRanges from the informer cache. Namespaces
+// created recently are listed from the API server unless a live list found
+// none moments ago.
+type limitRangeLister struct {
+	lister     corev1listers.LimitRangeLister
+	namespaces *namespaceGetter
+	client     kubernetes.Interface
+	empty      *utilcache.LRUExpireCache
+}
+
+func newLimitRangeLister(lister corev1listers.LimitRangeLister, namespaces *namespaceGetter, client kubernetes.Interface) *limitRangeLister {
+	return &limitRangeLister{
+		lister:     lister,
+		namespaces: namespaces,
+		client:     client,
+		empty:      utilcache.NewLRUExpireCache(negativeCacheSize),
+	}
+}
+
+func (l *limitRangeLister) List(ctx context.Context, namespace string) ([]*corev1.LimitRange, error) {
+	cached, err := l.lister.LimitRanges(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cached) > 0 || !l.isRecent(namespace) {
+		return cached, nil
+	}
+
+	if _, found := l.empty.Get(namespace); found {
+		metrics.RecordLiveLookup("limitranges", metrics.LookupNegativeCacheHit)
+		return cached, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, liveLookupTimeout)
+	defer cancel()
+
+	list, liveErr := l.client.CoreV1().LimitRanges(namespace).List(ctx, metav1.ListOptions{})
+	if liveErr != nil {
+		metrics.RecordLiveLookup("limitranges", metrics.LookupError)
+		klog.V(3).Infof("namespace=%s live LimitRange lookup failed, using cache - %v", namespace, liveErr)
+		return cached, nil
+	}
+
+	if len(list.Items) == 0 {
+		metrics.RecordLiveLookup("limitranges", metrics.LookupNotFound)
+		l.empty.Add(namespace, struct{}{}, negativeCacheTTL)
+		return cached, nil
+	}
+
+	metrics.RecordLiveLookup("limitranges", metrics.LookupFound)
+	limitRanges := make([]*corev1.LimitRange, 0, len(list.Items))
+	for i := range list.Items {
+		limitRanges = append(limitRanges, &list.Items[i])
+	}
+	return limitRanges, nil
+}
+
+// isRecent returns true if the namespace is missing from the cache or was
+// created recently.
+func (l *limitRangeLister) isRecent(namespace string) bool {
+	ns, err := l.namespaces.lister.Get(namespace)
+	if err != nil {
+		return true
+	}
+
+	return l.namespaces.isRecent(ns)
+}
+
+// forget drops the negative cache entry of the given namespace, it is called
+// once the informer observes a LimitRange in it.
+func (l *limitRangeLister) forget(namespace string) {
+	l.empty.Remove(namespace)
+}
+
+// forgetOnAdd returns a handler that calls forget with the name, or the
+// namespace, of every object the informer observes being added.
+func forgetOnAdd(forget func(string), key func(metav1.Object) string) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if object, ok := obj.(metav1.Object); ok {
+				forget(key(object))
+			}
+		},
+	}
+}
@@ -0,0 +1,147 @@
+package clusterresourceoverride
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestNamespaceGetter(t *testing.T, cached []*corev1.Namespace, live ...*corev1.Namespace) (*namespaceGetter, *fake.Clientset) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, ns := range cached {
+		require.NoError(t, indexer.Add(ns))
+	}
+
+	client := fake.NewSimpleClientset()
+	for _, ns := range live {
+		require.NoError(t, client.Tracker().Add(ns))
+	}
+
+	return newNamespaceGetter(corev1listers.NewNamespaceLister(indexer), client), client
+}
+
+func countActions(client *fake.Clientset, verb, resource string) int {
+	count := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == verb && action.GetResource().Resource == resource {
+			count++
+		}
+	}
+	return count
+}
+
+func TestNamespaceGetter(t *testing.T) {
+	now := time.Now()
+	old := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "old", CreationTimestamp: metav1.NewTime(now.Add(-time.Hour))}}
+	recent := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "recent", CreationTimestamp: metav1.NewTime(now)}}
+	recentLabeled := recent.DeepCopy()
+	recentLabeled.Labels = map[string]string{EnabledLabelName: "true"}
+	uncached := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "uncached", CreationTimestamp: metav1.NewTime(now)}}
+
+	t.Run("WithOldCachedNamespace", func(t *testing.T) {
+		getter, client := newTestNamespaceGetter(t, []*corev1.Namespace{old})
+
+		nsGot, errGot := getter.Get(context.TODO(), "old")
+		require.NoError(t, errGot)
+		assert.Equal(t, "old", nsGot.Name)
+		assert.Empty(t, client.Actions())
+	})
+
+	t.Run("WithRecentNamespaceLabeledAfterCreation", func(t *testing.T) {
+		getter, _ := newTestNamespaceGetter(t, []*corev1.Namespace{recent}, recentLabeled)
+
+		nsGot, errGot := getter.Get(context.TODO(), "recent")
+		require.NoError(t, errGot)
+		assert.Equal(t, "true", nsGot.Labels[EnabledLabelName])
+	})
+
+	t.Run("WithRecentNamespaceIsPositivelyCached", func(t *testing.T) {
+		getter, client := newTestNamespaceGetter(t, []*corev1.Namespace{recent}, recent)
+
+		for i := 0; i < 3; i++ {
+			nsGot, errGot := getter.Get(context.TODO(), "recent")
+			require.NoError(t, errGot)
+			assert.Equal(t, "recent", nsGot.Name)
+		}
+		assert.Equal(t, 1, countActions(client, "get", "namespaces"))
+	})
+
+	t.Run("WithNamespaceMissingFromCache", func(t *testing.T) {
+		getter, _ := newTestNamespaceGetter(t, nil, uncached)
+
+		nsGot, errGot := getter.Get(context.TODO(), "uncached")
+		require.NoError(t, errGot)
+		assert.Equal(t, "uncached", nsGot.Name)
+	})
+
+	t.Run("WithMissingNamespaceIsNegativelyCached", func(t *testing.T) {
+		getter, client := newTestNamespaceGetter(t, nil)
+
+		for i := 0; i < 3; i++ {
+			_, errGot := getter.Get(context.TODO(), "missing")
+			assert.True(t, k8serrors.IsNotFound(errGot))
+		}
+		assert.Equal(t, 1, countActions(client, "get", "namespaces"))
+
+		getter.forget("missing")
+		_, errGot := getter.Get(context.TODO(), "missing")
+		assert.True(t, k8serrors.IsNotFound(errGot))
+		assert.Equal(t, 2, countActions(client, "get", "namespaces"))
+	})
+}
+
+func TestLimitRangeLister(t *testing.T) {
+	now := time.Now()
+	old := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "old", CreationTimestamp: metav1.NewTime(now.Add(-time.Hour))}}
+	recent := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "recent", CreationTimestamp: metav1.NewTime(now)}}
+	limitRange := func(namespace string) *corev1.LimitRange {
+		return &corev1.LimitRange{ObjectMeta: metav1.ObjectMeta{Name: "limits", Namespace: namespace}}
+	}
+
+	newLister := func(t *testing.T, live ...*corev1.LimitRange) (*limitRangeLister, *fake.Clientset) {
+		getter, client := newTestNamespaceGetter(t, []*corev1.Namespace{old, recent})
+		for _, lr := range live {
+			require.NoError(t, client.Tracker().Add(lr))
+		}
+
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		return newLimitRangeLister(corev1listers.NewLimitRangeLister(indexer), getter, client), client
+	}
+
+	t.Run("WithOldNamespace", func(t *testing.T) {
+		lister, client := newLister(t, limitRange("old"))
+
+		listGot, errGot := lister.List(context.TODO(), "old")
+		require.NoError(t, errGot)
+		assert.Empty(t, listGot)
+		assert.Empty(t, client.Actions())
+	})
+
+	t.Run("WithLimitRangeMissingFromCache", func(t *testing.T) {
+		lister, _ := newLister(t, limitRange("recent"))
+
+		listGot, errGot := lister.List(context.TODO(), "recent")
+		require.NoError(t, errGot)
+		assert.Len(t, listGot, 1)
+	})
+
+	t.Run("WithNoLimitRangeIsNegativelyCached", func(t *testing.T) {
+		lister, client := newLister(t)
+
+		for i := 0; i < 3; i++ {
+			listGot, errGot := lister.List(context.TODO(), "recent")
+			require.NoError(t, errGot)
+			assert.Empty(t, listGot)
+		}
+		assert.Equal(t, 1, countActions(client, "list", "limitranges"))
+	})
+}
@@ -0,0 +1,169 @@
+package clusterresourceoverride
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// stalenessThresholdEnvName is the name of the environment variable that
+	// holds how long an informer may go without receiving an event before the
+	// webhook is reported as not alive.
+	stalenessThresholdEnvName = "INFORMER_STALENESS_THRESHOLD"
+)
+
+// informerActivity keeps track of the informers backing the admission logic:
+// whether they have synced, when they last made progress on their watch and
+// how many objects they cache, counted from their events. An informer makes
+// progress when it receives an event, or when the resource version it last
+// synced to moves, as watch bookmarks do. Resyncs replay the cache of the
+// informer and are not progress, they go on while its watch is stuck.
+type informerActivity struct {
+	lock      sync.RWMutex
+	threshold time.Duration
+	now       func() time.Time
+	synced    map[string]cache.InformerSynced
+	lastEvent map[string]time.Time
+	objects   map[string]int
+
+	// version returns the resource version the informer last synced to,
+	// lastVersion is the one it had when last checked.
+	version     map[string]func() string
+	lastVersion map[string]string
+}
+
+func newInformerActivity(threshold time.Duration) *informerActivity {
+	return &informerActivity{
+		threshold:   threshold,
+		now:         time.Now,
+		synced:      map[string]cache.InformerSynced{},
+		lastEvent:   map[string]time.Time{},
+		objects:     map[string]int{},
+		version:     map[string]func() string{},
+		lastVersion: map[string]string{},
+	}
+}
+
+// track registers the given informer under name.
+func (a *informerActivity) track(name string, informer cache.SharedIndexInformer) error {
+	a.lock.Lock()
+	a.synced[name] = informer.HasSynced
+	a.version[name] = informer.LastSyncResourceVersion
+	a.lastEvent[name] = a.now()
+	a.lock.Unlock()
+
+	_, err := informer.AddEventHandler(a.handler(name))
+	return err
+}
+
+// handler returns the event handler observing the informer registered under
+// name.
+func (a *informerActivity) handler(name string) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { a.observe(name, 1) },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if isResync(oldObj, newObj) {
+				return
+			}
+			a.observe(name, 0)
+		},
+		DeleteFunc: func(interface{}) { a.observe(name, -1) },
+	}
+}
+
+// isResync returns true if an update is the replay of an object the informer
+// already cached.
+func isResync(oldObj, newObj interface{}) bool {
+	oldObject, ok := oldObj.(metav1.Object)
+	if !ok {
+		return false
+	}
+	newObject, ok := newObj.(metav1.Object)
+	if !ok {
+		return false
+	}
+
+	return oldObject.GetResourceVersion() == newObject.GetResourceVersion()
+}
+
+// observe records an event of the informer registered under name, which
+// changed the number of objects it caches by delta.
+func (a *informerActivity) observe(name string, delta int) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.lastEvent[name] = a.now()
+	a.objects[name] += delta
+}
+
+// HasSynced returns true once every tracked informer has synced.
+func (a *informerActivity) HasSynced() bool {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	for _, synced := range a.synced {
+		if !synced() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CheckStaleness returns an error naming the informers that have not made
+// progress within the threshold. A zero threshold disables the check.
+// Informers that cache no objects may not be sent bookmarks, so they are never
+// stale.
+func (a *informerActivity) CheckStaleness() error {
+	if a.threshold == 0 {
+		return nil
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for name, version := range a.version {
+		if current := version(); current != a.lastVersion[name] {
+			a.lastVersion[name] = current
+			a.lastEvent[name] = a.now()
+		}
+	}
+
+	stale := []string{}
+	for name, last := range a.lastEvent {
+		if a.objects[name] <= 0 {
+			continue
+		}
+
+		if a.now().Sub(last) > a.threshold {
+			stale = append(stale, fmt.Sprintf("%s (last event %s ago)", name, a.now().Sub(last).Round(time.Second)))
+		}
+	}
+
+	if len(stale) == 0 {
+		return nil
+	}
+
+	sort.Strings(stale)
+	return fmt.Errorf("informers have not received events for more than %s: %v", a.threshold, stale)
+}
+
+func durationFromEnv(name string, defaultValue time.Duration) (value time.Duration, err error) {
+	str := os.Getenv(name)
+	if str == "" {
+		value = defaultValue
+		return
+	}
+
+	value, err = time.ParseDuration(str)
+	if err != nil || value < 0 {
+		err = fmt.Errorf("env var %s=%q must be a non-negative duration", name, str)
+	}
+	return
+}
@@ -0,0 +1,96 @@
+package clusterresourceoverride
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInformerActivity(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	activity := newInformerActivity(10 * time.Minute)
+	activity.now = func() time.Time { return now }
+
+	synced := false
+	activity.synced["namespaces"] = func() bool { return synced }
+	activity.observe("namespaces", 1)
+
+	assert.False(t, activity.HasSynced())
+	synced = true
+	assert.True(t, activity.HasSynced())
+
+	now = now.Add(5 * time.Minute)
+	assert.NoError(t, activity.CheckStaleness())
+
+	now = now.Add(10 * time.Minute)
+	err := activity.CheckStaleness()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "namespaces")
+
+	activity.objects["namespaces"] = 0
+	assert.NoError(t, activity.CheckStaleness())
+	activity.objects["namespaces"] = 1
+	assert.Error(t, activity.CheckStaleness())
+
+	activity.observe("namespaces", -1)
+	assert.NoError(t, activity.CheckStaleness())
+	assert.Equal(t, now, activity.lastEvent["namespaces"])
+
+	activity.threshold = 0
+	assert.NoError(t, activity.CheckStaleness())
+}
+
+func TestInformerActivityWithResyncsOnly(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	activity := newInformerActivity(10 * time.Minute)
+	activity.now = func() time.Time { return now }
+
+	version := "1"
+	activity.version["namespaces"] = func() string { return version }
+	handler := activity.handler("namespaces")
+
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "foo", ResourceVersion: "1"}}
+	handler.OnAdd(namespace, true)
+	assert.NoError(t, activity.CheckStaleness())
+
+	// resyncs replay the cached namespace while the watch is stuck.
+	for i := 0; i < 3; i++ {
+		now = now.Add(5 * time.Minute)
+		handler.OnUpdate(namespace, namespace)
+	}
+	err := activity.CheckStaleness()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "namespaces")
+
+	// a bookmark moves the resource version the informer synced to.
+	version = "2"
+	assert.NoError(t, activity.CheckStaleness())
+
+	now = now.Add(15 * time.Minute)
+	updated := namespace.DeepCopy()
+	updated.ResourceVersion = "3"
+	handler.OnUpdate(namespace, updated)
+	assert.NoError(t, activity.CheckStaleness())
+}
+
+func TestDurationFromEnv(t *testing.T) {
+	t.Setenv(stalenessThresholdEnvName, "")
+	valueGot, errGot := durationFromEnv(stalenessThresholdEnvName, time.Hour)
+	assert.NoError(t, errGot)
+	assert.Equal(t, time.Hour, valueGot)
+
+	t.Setenv(stalenessThresholdEnvName, "30m")
+	valueGot, errGot = durationFromEnv(stalenessThresholdEnvName, time.Hour)
+	assert.NoError(t, errGot)
+	assert.Equal(t, 30*time.Minute, valueGot)
+
+	t.Setenv(stalenessThresholdEnvName, "soon")
+	_, errGot = durationFromEnv(stalenessThresholdEnvName, time.Hour)
+	assert.Error(t, errGot)
+}
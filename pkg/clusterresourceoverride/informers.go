@@ -0,0 +1,208 @@
+package clusterresourceoverride
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metainternalversionscheme "k8s.io/apimachinery/pkg/apis/meta/internalversion/scheme"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// resyncPeriodEnvName is the name of the environment variable that holds
+	// the resync period of the informers.
+	resyncPeriodEnvName = "INFORMER_RESYNC_PERIOD"
+
+	// optInNamespacesOnlyEnvName is the name of the environment variable that,
+	// if "true", limits the Namespace watches to namespaces that opted in.
+	optInNamespacesOnlyEnvName = "NAMESPACE_WATCH_OPT_IN_ONLY"
+
+	// The API server converts objects to PartialObjectMetadata when asked to,
+	// so only their metadata is sent and cached.
+	partialObjectMetadataListAccept = "application/json;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1"
+	partialObjectMetadataAccept     = "application/json;as=PartialObjectMetadata;g=meta.k8s.io;v=v1"
+)
+
+// newNamespaceMetadataInformer returns an informer that only watches the
+// metadata of namespaces, which is all the admission logic uses. Objects are
+// cached as Namespaces with an empty spec and status, so that they can be
+// read with a NamespaceLister.
+func newNamespaceMetadataInformer(kubeClientConfig *restclient.Config, resyncPeriod time.Duration, labelSelector string) (informer cache.SharedIndexInformer, err error) {
+	informer, err = newMetadataInformer(kubeClientConfig, resyncPeriod, corev1.SchemeGroupVersion, "namespaces", labelSelector)
+	if err != nil {
+		return
+	}
+
+	if transformErr := informer.SetTransform(namespaceFromMetadata); transformErr != nil {
+		err = fmt.Errorf("failed to set Namespace transform - %s", transformErr.Error())
+	}
+	return
+}
+
+// newOwnerMetadataInformer returns an informer that only watches the metadata
+// of the given resource in all namespaces, which is enough to follow their
+// owner references. Objects are cached as PartialObjectMetadata.
+func newOwnerMetadataInformer(kubeClientConfig *restclient.Config, resyncPeriod time.Duration, groupVersion schema.GroupVersion, resource string) (informer cache.SharedIndexInformer, err error) {
+	informer, err = newMetadataInformer(kubeClientConfig, resyncPeriod, groupVersion, resource, "")
+	if err != nil {
+		return
+	}
+
+	if transformErr := informer.SetTransform(stripManagedFields); transformErr != nil {
+		err = fmt.Errorf("failed to set %s transform - %s", resource, transformErr.Error())
+	}
+	return
+}
+
+// newMetadataInformer returns an informer that lists and watches the
+// PartialObjectMetadata of the given resource.
+func newMetadataInformer(kubeClientConfig *restclient.Config, resyncPeriod time.Duration, groupVersion schema.GroupVersion, resource string, labelSelector string) (informer cache.SharedIndexInformer, err error) {
+	config := restclient.CopyConfig(kubeClientConfig)
+	config.APIPath = "/apis"
+	if groupVersion.Group == "" {
+		config.APIPath = "/api"
+	}
+	config.GroupVersion = &groupVersion
+	config.ContentType = runtime.ContentTypeJSON
+	config.AcceptContentTypes = runtime.ContentTypeJSON
+	config.NegotiatedSerializer = metainternalversionscheme.Codecs.WithoutConversion()
+
+	client, clientErr := restclient.RESTClientFor(config)
+	if clientErr != nil {
+		err = fmt.Errorf("failed to create metadata client - %s", clientErr.Error())
+		return
+	}
+
+	listWatch := &cache.ListWatch{
+		ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = labelSelector
+
+			list := &metav1.PartialObjectMetadataList{}
+			err := client.Get().
+				Resource(resource).
+				VersionedParams(&options, metav1.ParameterCodec).
+				SetHeader("Accept", partialObjectMetadataListAccept).
+				Do(ctx).
+				Into(list)
+			return list, err
+		},
+		WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = labelSelector
+			options.Watch = true
+
+			return client.Get().
+				Resource(resource).
+				VersionedParams(&options, metav1.ParameterCodec).
+				SetHeader("Accept", partialObjectMetadataAccept).
+				Watch(ctx)
+		},
+	}
+
+	informer = cache.NewSharedIndexInformer(listWatch, &metav1.PartialObjectMetadata{}, resyncPeriod, cache.Indexers{})
+	return
+}
+
+// namespaceFromMetadata converts the PartialObjectMetadata of a namespace to
+// a Namespace, dropping its managed fields.
+func namespaceFromMetadata(obj interface{}) (interface{}, error) {
+	metadata, ok := obj.(*metav1.PartialObjectMetadata)
+	if !ok {
+		return obj, nil
+	}
+
+	objectMeta := metadata.ObjectMeta
+	objectMeta.ManagedFields = nil
+
+	return &corev1.Namespace{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Namespace",
+		},
+		ObjectMeta: objectMeta,
+	}, nil
+}
+
+// stripManagedFields drops the managed fields of cached objects, the
+// admission logic never reads them.
+func stripManagedFields(obj interface{}) (interface{}, error) {
+	if accessor, ok := obj.(metav1.Object); ok {
+		accessor.SetManagedFields(nil)
+	}
+
+	return obj, nil
+}
+
+// namespaceLabelSelectors returns the label selectors of the Namespace
+// watches, one informer each. The webhook configuration only sends pods of
+// namespaces that opted in, so the others need not be cached. A label selector
+// can't match either of two labels, so each of the labels a namespace opts in
+// with is watched on its own.
+func namespaceLabelSelectors() (selectors []string, err error) {
+	selectors = []string{""}
+
+	value := os.Getenv(optInNamespacesOnlyEnvName)
+	if value == "" {
+		return
+	}
+
+	optInOnly, parseErr := strconv.ParseBool(value)
+	if parseErr != nil {
+		err = fmt.Errorf("env var %s=%q must be a boolean", optInNamespacesOnlyEnvName, value)
+		return
+	}
+
+	if optInOnly {
+		selectors = []string{
+			fmt.Sprintf("%s=true", EnabledLabelName),
+			fmt.Sprintf("%s=true", SelinuxFixEnabledLabelName),
+		}
+	}
+	return
+}
+
+// namespaceListers reads namespaces from the caches of several informers as
+// if they were one. A namespace that opted in with more than one label is
+// cached by more than one of them.
+type namespaceListers []corev1listers.NamespaceLister
+
+func (l namespaceListers) List(selector labels.Selector) (namespaces []*corev1.Namespace, err error) {
+	seen := map[string]bool{}
+	for _, lister := range l {
+		listed, listErr := lister.List(selector)
+		if listErr != nil {
+			err = listErr
+			return
+		}
+
+		for _, ns := range listed {
+			if seen[ns.Name] {
+				continue
+			}
+			seen[ns.Name] = true
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return
+}
+
+func (l namespaceListers) Get(name string) (ns *corev1.Namespace, err error) {
+	for _, lister := range l {
+		ns, err = lister.Get(name)
+		if err == nil || !k8serrors.IsNotFound(err) {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,224 @@
+package clusterresourceoverride
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestNamespaceMetadataInformer(t *testing.T) {
+	namespace := `{
+		"apiVersion": "meta.k8s.io/v1",
+		"kind": "PartialObjectMetadata",
+		"metadata": {
+			"name": "foo",
+			"resourceVersion": "9",
+			"labels": {"clusterresourceoverrides.admission.autoscaling.openshift.io/enabled": "true"},
+			"managedFields": [{"manager": "kubectl", "operation": "Update"}]
+		}
+	}`
+
+	var lock sync.Mutex
+	selectors := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		selectors = append(selectors, r.URL.Query().Get("labelSelector"))
+		lock.Unlock()
+
+		if !strings.Contains(r.Header.Get("Accept"), "as=PartialObjectMetadata") {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("watch") == "true" {
+			// the reflector asks for the initial objects as a stream of events.
+			if r.URL.Query().Get("sendInitialEvents") == "true" {
+				fmt.Fprintf(w, `{"type": "ADDED", "object": %s}`, namespace)
+				fmt.Fprint(w, `{"type": "BOOKMARK", "object": {
+					"apiVersion": "meta.k8s.io/v1",
+					"kind": "PartialObjectMetadata",
+					"metadata": {"resourceVersion": "10", "annotations": {"k8s.io/initial-events-end": "true"}}
+				}}`)
+			}
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+
+		fmt.Fprintf(w, `{
+			"apiVersion": "meta.k8s.io/v1",
+			"kind": "PartialObjectMetadataList",
+			"metadata": {"resourceVersion": "10"},
+			"items": [%s]
+		}`, namespace)
+	}))
+	defer server.Close()
+
+	selector := fmt.Sprintf("%s=true", EnabledLabelName)
+	informer, err := newNamespaceMetadataInformer(&restclient.Config{Host: server.URL}, 0, selector)
+	require.NoError(t, err)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go informer.Run(stopCh)
+	require.True(t, cache.WaitForCacheSync(stopCh, informer.HasSynced))
+
+	obj, exists, err := informer.GetIndexer().GetByKey("foo")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	ns, ok := obj.(*corev1.Namespace)
+	require.True(t, ok)
+	assert.Equal(t, "true", ns.Labels[EnabledLabelName])
+	assert.Empty(t, ns.ManagedFields)
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.NotEmpty(t, selectors)
+	for _, selectorGot := range selectors {
+		assert.Equal(t, selector, selectorGot)
+	}
+}
+
+func TestNamespaceLabelSelectors(t *testing.T) {
+	t.Setenv(optInNamespacesOnlyEnvName, "")
+	selectorsGot, errGot := namespaceLabelSelectors()
+	assert.NoError(t, errGot)
+	assert.Equal(t, []string{""}, selectorsGot)
+
+	t.Setenv(optInNamespacesOnlyEnvName, "true")
+	selectorsGot, errGot = namespaceLabelSelectors()
+	assert.NoError(t, errGot)
+	assert.Equal(t, []string{EnabledLabelName + "=true", SelinuxFixEnabledLabelName + "=true"}, selectorsGot)
+
+	t.Setenv(optInNamespacesOnlyEnvName, "sometimes")
+	_, errGot = namespaceLabelSelectors()
+	assert.Error(t, errGot)
+}
+
+func TestNamespaceListers(t *testing.T) {
+	namespace := func(name string, labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+
+	enabled := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	require.NoError(t, enabled.Add(namespace("both", map[string]string{EnabledLabelName: "true", SelinuxFixEnabledLabelName: "true"})))
+	require.NoError(t, enabled.Add(namespace("overrides", map[string]string{EnabledLabelName: "true"})))
+
+	selinuxFixEnabled := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	require.NoError(t, selinuxFixEnabled.Add(namespace("both", map[string]string{EnabledLabelName: "true", SelinuxFixEnabledLabelName: "true"})))
+	require.NoError(t, selinuxFixEnabled.Add(namespace("selinux", map[string]string{SelinuxFixEnabledLabelName: "true"})))
+
+	listers := namespaceListers{
+		corev1listers.NewNamespaceLister(enabled),
+		corev1listers.NewNamespaceLister(selinuxFixEnabled),
+	}
+
+	for _, name := range []string{"both", "overrides", "selinux"} {
+		ns, err := listers.Get(name)
+		require.NoError(t, err)
+		assert.Equal(t, name, ns.Name)
+	}
+
+	_, err := listers.Get("other")
+	assert.True(t, k8serrors.IsNotFound(err))
+
+	listed, err := listers.List(labels.Everything())
+	require.NoError(t, err)
+	names := []string{}
+	for _, ns := range listed {
+		names = append(names, ns.Name)
+	}
+	assert.ElementsMatch(t, []string{"both", "overrides", "selinux"}, names)
+}
+
+func TestOwnerMetadataInformer(t *testing.T) {
+	replicaSet := `{
+		"apiVersion": "meta.k8s.io/v1",
+		"kind": "PartialObjectMetadata",
+		"metadata": {
+			"name": "web-5d8f",
+			"namespace": "foo",
+			"resourceVersion": "9",
+			"ownerReferences": [{"apiVersion": "apps/v1", "kind": "Deployment", "name": "web", "uid": "1", "controller": true}],
+			"managedFields": [{"manager": "kube-controller-manager", "operation": "Update"}]
+		}
+	}`
+
+	var lock sync.Mutex
+	paths := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		paths = append(paths, r.URL.Path)
+		lock.Unlock()
+
+		if !strings.Contains(r.Header.Get("Accept"), "as=PartialObjectMetadata") {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("watch") == "true" {
+			if r.URL.Query().Get("sendInitialEvents") == "true" {
+				fmt.Fprintf(w, `{"type": "ADDED", "object": %s}`, replicaSet)
+				fmt.Fprint(w, `{"type": "BOOKMARK", "object": {
+					"apiVersion": "meta.k8s.io/v1",
+					"kind": "PartialObjectMetadata",
+					"metadata": {"resourceVersion": "10", "annotations": {"k8s.io/initial-events-end": "true"}}
+				}}`)
+			}
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+
+		fmt.Fprintf(w, `{
+			"apiVersion": "meta.k8s.io/v1",
+			"kind": "PartialObjectMetadataList",
+			"metadata": {"resourceVersion": "10"},
+			"items": [%s]
+		}`, replicaSet)
+	}))
+	defer server.Close()
+
+	informer, err := newOwnerMetadataInformer(&restclient.Config{Host: server.URL}, 0, appsv1.SchemeGroupVersion, "replicasets")
+	require.NoError(t, err)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go informer.Run(stopCh)
+	require.True(t, cache.WaitForCacheSync(stopCh, informer.HasSynced))
+
+	obj, exists, err := informer.GetIndexer().GetByKey("foo/web-5d8f")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	metadata, ok := obj.(*metav1.PartialObjectMetadata)
+	require.True(t, ok)
+	assert.Equal(t, "Deployment", metav1.GetControllerOf(metadata).Kind)
+	assert.Empty(t, metadata.ManagedFields)
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.NotEmpty(t, paths)
+	for _, pathGot := range paths {
+		assert.Equal(t, "/apis/apps/v1/replicasets", pathGot)
+	}
+}
@@ -1,43 +1,89 @@
 package clusterresourceoverride
 
 import (
+	"context"
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
-	"k8s.io/apimachinery/pkg/labels"
-	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	"github.com/openshift/cluster-resource-override-admission/pkg/tracing"
 )
 
 type namespaceLimitQuerier struct {
-	limitRangesLister corev1listers.LimitRangeLister
+	limitRanges *limitRangeLister
+
+	// bounds is optional, the bounds are computed for every query without it.
+	bounds *boundsCache
 }
 
-func (l *namespaceLimitQuerier) QueryFloorAndCeiling(namespace string) (floor *CPUMemory, ceiling *CPUMemory, err error) {
-	limitRanges, listErr := l.limitRangesLister.LimitRanges(namespace).List(labels.Everything())
+// QueryBounds returns the floor and ceiling of the containers and of the
+// pods of the namespace.
+func (l *namespaceLimitQuerier) QueryBounds(ctx context.Context, namespace string) (bounds *namespaceBounds, err error) {
+	ctx, span := tracing.Start(ctx, "QueryBounds", tracing.NamespaceKey.String(namespace))
+	defer span.End()
+
+	limitRanges, listErr := l.limitRanges.List(ctx, namespace)
 	if listErr != nil {
 		err = fmt.Errorf("failed to query limitrange - %v", listErr)
+		span.RecordError(err)
+		return
+	}
+
+	if cached, found := l.bounds.get(namespace, limitRanges); found {
+		bounds = cached
 		return
 	}
 
 	nsCPUMinimum, nsCPUMaximum := GetMinMax(limitRanges, corev1.ResourceCPU)
 	nsMemMinimum, nsMemMaximum := GetMinMax(limitRanges, corev1.ResourceMemory)
-
-	floor = &CPUMemory{
-		CPU:    nsCPUMinimum,
-		Memory: nsMemMinimum,
-	}
-	ceiling = &CPUMemory{
-		CPU:    nsCPUMaximum,
-		Memory: nsMemMaximum,
+	podCPUMinimum, podCPUMaximum := GetPodMinMax(limitRanges, corev1.ResourceCPU)
+	podMemMinimum, podMemMaximum := GetPodMinMax(limitRanges, corev1.ResourceMemory)
+
+	bounds = &namespaceBounds{
+		floor: &CPUMemory{
+			CPU:    nsCPUMinimum,
+			Memory: nsMemMinimum,
+		},
+		ceiling: &CPUMemory{
+			CPU:    nsCPUMaximum,
+			Memory: nsMemMaximum,
+		},
+		podFloor: &CPUMemory{
+			CPU:    podCPUMinimum,
+			Memory: podMemMinimum,
+		},
+		podCeiling: &CPUMemory{
+			CPU:    podCPUMaximum,
+			Memory: podMemMaximum,
+		},
+		limitRequestRatio: &CPUMemory{
+			CPU:    GetMaxLimitRequestRatio(limitRanges, corev1.LimitTypeContainer, corev1.ResourceCPU),
+			Memory: GetMaxLimitRequestRatio(limitRanges, corev1.LimitTypeContainer, corev1.ResourceMemory),
+		},
+		podLimitRequestRatio: &CPUMemory{
+			CPU:    GetMaxLimitRequestRatio(limitRanges, corev1.LimitTypePod, corev1.ResourceCPU),
+			Memory: GetMaxLimitRequestRatio(limitRanges, corev1.LimitTypePod, corev1.ResourceMemory),
+		},
 	}
+
+	l.bounds.add(namespace, limitRanges, bounds)
 	return
 }
 
 // GetMinMax finds the Minimum and Maximum limit for respectively for the specified resource.
 // Nil is returned if limitRanges is empty or limits contains no resourceName limits.
 func GetMinMax(limitRanges []*corev1.LimitRange, resourceName corev1.ResourceName) (minimum *resource.Quantity, maximum *resource.Quantity) {
-	minList, maxList := findMinMaxLimits(limitRanges, resourceName)
+	return getMinMax(limitRanges, corev1.LimitTypeContainer, resourceName)
+}
+
+// GetPodMinMax is GetMinMax for the limits that apply to the whole pod.
+func GetPodMinMax(limitRanges []*corev1.LimitRange, resourceName corev1.ResourceName) (minimum *resource.Quantity, maximum *resource.Quantity) {
+	return getMinMax(limitRanges, corev1.LimitTypePod, resourceName)
+}
+
+func getMinMax(limitRanges []*corev1.LimitRange, limitType corev1.LimitType, resourceName corev1.ResourceName) (minimum *resource.Quantity, maximum *resource.Quantity) {
+	minList, maxList := findMinMaxLimits(limitRanges, limitType, resourceName)
 
 	minimum = minQuantity(minList)
 	maximum = maxQuantity(maxList)
@@ -45,13 +91,29 @@ func GetMinMax(limitRanges []*corev1.LimitRange, resourceName corev1.ResourceNam
 	return
 }
 
-func findMinMaxLimits(limitRanges []*corev1.LimitRange, resourceName corev1.ResourceName) (minimum []*resource.Quantity, maximum []*resource.Quantity) {
+// GetMaxLimitRequestRatio finds the smallest maxLimitRequestRatio of the given
+// type for the specified resource, nil if there is none.
+func GetMaxLimitRequestRatio(limitRanges []*corev1.LimitRange, limitType corev1.LimitType, resourceName corev1.ResourceName) *resource.Quantity {
+	ratios := []*resource.Quantity{}
+	for _, limitRange := range limitRanges {
+		for _, limits := range limitRange.Spec.Limits {
+			if ratio, found := limits.MaxLimitRequestRatio[resourceName]; found && limits.Type == limitType {
+				clone := ratio.DeepCopy()
+				ratios = append(ratios, &clone)
+			}
+		}
+	}
+
+	return minQuantity(ratios)
+}
+
+func findMinMaxLimits(limitRanges []*corev1.LimitRange, limitType corev1.LimitType, resourceName corev1.ResourceName) (minimum []*resource.Quantity, maximum []*resource.Quantity) {
 	minimum = []*resource.Quantity{}
 	maximum = []*resource.Quantity{}
 
 	for _, limitRange := range limitRanges {
 		for _, limits := range limitRange.Spec.Limits {
-			if limits.Type == corev1.LimitTypeContainer {
+			if limits.Type == limitType {
 				if min, found := limits.Min[resourceName]; found {
 					clone := min.DeepCopy()
 					minimum = append(minimum, &clone)
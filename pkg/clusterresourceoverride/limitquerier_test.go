@@ -79,3 +79,64 @@ func TestGetMinMax(t *testing.T) {
 		})
 	}
 }
+
+func TestGetPodMinMax(t *testing.T) {
+	limitRanges := []*corev1.LimitRange{
+		{
+			Spec: corev1.LimitRangeSpec{
+				Limits: []corev1.LimitRangeItem{
+					{
+						Type: corev1.LimitTypeContainer,
+						Min:  corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+					},
+					{
+						Type: corev1.LimitTypePod,
+						Min:  corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+						Max:  corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("4Gi")},
+					},
+				},
+			},
+		},
+	}
+
+	minimumGot, maximumGot := GetPodMinMax(limitRanges, corev1.ResourceMemory)
+	assert.Equal(t, "512Mi", minimumGot.String())
+	assert.Equal(t, "4Gi", maximumGot.String())
+
+	minimumGot, maximumGot = GetPodMinMax(limitRanges, corev1.ResourceCPU)
+	assert.Nil(t, minimumGot)
+	assert.Nil(t, maximumGot)
+}
+
+func TestGetMaxLimitRequestRatio(t *testing.T) {
+	limitRanges := []*corev1.LimitRange{
+		{
+			Spec: corev1.LimitRangeSpec{
+				Limits: []corev1.LimitRangeItem{
+					{
+						Type:                 corev1.LimitTypeContainer,
+						MaxLimitRequestRatio: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4")},
+					},
+					{
+						Type:                 corev1.LimitTypePod,
+						MaxLimitRequestRatio: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("8")},
+					},
+				},
+			},
+		},
+		{
+			Spec: corev1.LimitRangeSpec{
+				Limits: []corev1.LimitRangeItem{
+					{
+						Type:                 corev1.LimitTypeContainer,
+						MaxLimitRequestRatio: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")},
+					},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, "2", GetMaxLimitRequestRatio(limitRanges, corev1.LimitTypeContainer, corev1.ResourceCPU).String())
+	assert.Equal(t, "8", GetMaxLimitRequestRatio(limitRanges, corev1.LimitTypePod, corev1.ResourceCPU).String())
+	assert.Nil(t, GetMaxLimitRequestRatio(limitRanges, corev1.LimitTypeContainer, corev1.ResourceMemory))
+}
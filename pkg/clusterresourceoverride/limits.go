@@ -0,0 +1,49 @@
+package clusterresourceoverride
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// DeriveLimits sets the missing memory and CPU limits to a percentage of the
+// requests, within the namespace maximum, so that containers that only set
+// requests are bounded. CPU limits are not derived if they are removed
+// afterwards. It returns the resources whose limit was derived, the requests
+// of which were set by the user and are not overridden from the limit.
+func (m *podMutator) DeriveLimits(resources *corev1.ResourceRequirements) (derived map[corev1.ResourceName]bool) {
+	derived = map[corev1.ResourceName]bool{}
+	derived[corev1.ResourceMemory] = m.deriveLimit(resources, corev1.ResourceMemory, m.config.MemoryLimitToRequestRatio)
+
+	if m.config.CPULimitMode != CPULimitModeNone {
+		derived[corev1.ResourceCPU] = m.deriveLimit(resources, corev1.ResourceCPU, m.config.CPULimitToRequestRatio)
+	}
+	return
+}
+
+func (m *podMutator) deriveLimit(resources *corev1.ResourceRequirements, name corev1.ResourceName, ratio float64) bool {
+	if ratio == 0 {
+		return false
+	}
+
+	if _, found := resources.Limits[name]; found {
+		return false
+	}
+
+	request, found := resources.Requests[name]
+	if !found || request.IsZero() {
+		return false
+	}
+
+	derived := scaleQuantity(request, name, ratio, false)
+	overridden := m.clamp(name, FieldLimit, &derived)
+	klog.V(5).Infof("%s limit not set; setting limit to %q from request %q", name, overridden.String(), request.String())
+
+	ensureLimits(resources)
+	resources.Limits[name] = *overridden
+
+	// the namespace maximum may be below the request.
+	if request.Cmp(*overridden) > 0 {
+		resources.Requests[name] = overridden.DeepCopy()
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package clusterresourceoverride
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestDeriveLimits(t *testing.T) {
+	quantity := func(value string) *resource.Quantity { q := resource.MustParse(value); return &q }
+
+	tests := []struct {
+		name              string
+		config            *Config
+		ceiling           *CPUMemory
+		resources         corev1.ResourceRequirements
+		wantCPURequest    string
+		wantCPULimit      string
+		wantMemoryRequest string
+		wantMemoryLimit   string
+		wantClamps        int
+	}{
+		{
+			name:              "WithRequestsOnly",
+			config:            &Config{MemoryLimitToRequestRatio: 2, CPULimitToRequestRatio: 4},
+			resources:         newTestPod(newTestContainer("app", "250m", "", "512Mi", "")).Spec.Containers[0].Resources,
+			wantCPURequest:    "250m",
+			wantCPULimit:      "1",
+			wantMemoryRequest: "512Mi",
+			wantMemoryLimit:   "1Gi",
+		},
+		{
+			name:              "WithLimitsSet",
+			config:            &Config{MemoryLimitToRequestRatio: 2, CPULimitToRequestRatio: 4},
+			resources:         newTestPod(newTestContainer("app", "250m", "500m", "512Mi", "768Mi")).Spec.Containers[0].Resources,
+			wantCPURequest:    "250m",
+			wantCPULimit:      "500m",
+			wantMemoryRequest: "512Mi",
+			wantMemoryLimit:   "768Mi",
+		},
+		{
+			name:              "WithRequestKeptFromDerivedLimit",
+			config:            &Config{MemoryLimitToRequestRatio: 2, MemoryRequestToLimitRatio: 0.25, CPULimitToRequestRatio: 4, CpuRequestToLimitRatio: 0.1},
+			resources:         newTestPod(newTestContainer("app", "250m", "", "512Mi", "")).Spec.Containers[0].Resources,
+			wantCPURequest:    "250m",
+			wantCPULimit:      "1",
+			wantMemoryRequest: "512Mi",
+			wantMemoryLimit:   "1Gi",
+		},
+		{
+			name:              "WithCPULimitFromDerivedMemoryLimit",
+			config:            &Config{MemoryLimitToRequestRatio: 2, LimitCPUToMemoryRatio: 1, CpuRequestToLimitRatio: 0.25},
+			resources:         newTestPod(newTestContainer("app", "", "", "512Mi", "")).Spec.Containers[0].Resources,
+			wantCPURequest:    "250m",
+			wantCPULimit:      "1",
+			wantMemoryRequest: "512Mi",
+			wantMemoryLimit:   "1Gi",
+		},
+		{
+			name:           "WithRequestMultipleFromRequest",
+			config:         &Config{CPULimitToRequestRatio: 4, CPULimitMode: CPULimitModeRequestMultiple, CPURequestMultipleRatio: 2},
+			resources:      newTestPod(newTestContainer("app", "250m", "", "", "")).Spec.Containers[0].Resources,
+			wantCPURequest: "250m",
+			wantCPULimit:   "500m",
+		},
+		{
+			name:              "WithCeiling",
+			config:            &Config{MemoryLimitToRequestRatio: 2},
+			ceiling:           &CPUMemory{Memory: quantity("768Mi")},
+			resources:         newTestPod(newTestContainer("app", "", "", "512Mi", "")).Spec.Containers[0].Resources,
+			wantMemoryRequest: "512Mi",
+			wantMemoryLimit:   "768Mi",
+			wantClamps:        1,
+		},
+		{
+			name:           "WithCPULimitsRemoved",
+			config:         &Config{CPULimitToRequestRatio: 4, CPULimitMode: CPULimitModeNone},
+			resources:      newTestPod(newTestContainer("app", "250m", "", "", "")).Spec.Containers[0].Resources,
+			wantCPURequest: "250m",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ceiling := tt.ceiling
+			if ceiling == nil {
+				ceiling = &CPUMemory{}
+			}
+			mutator, err := NewMutator(tt.config, &CPUMemory{}, ceiling, cpuBaseScaleFactor)
+			require.NoError(t, err)
+
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Resources: tt.resources}}}}
+			podGot, err := mutator.Mutate(pod)
+			require.NoError(t, err)
+
+			resources := podGot.Spec.Containers[0].Resources
+			quantityOf := func(list corev1.ResourceList, name corev1.ResourceName) string {
+				if quantity, found := list[name]; found {
+					return quantity.String()
+				}
+				return ""
+			}
+			assert.Equal(t, tt.wantCPURequest, quantityOf(resources.Requests, corev1.ResourceCPU))
+			assert.Equal(t, tt.wantCPULimit, quantityOf(resources.Limits, corev1.ResourceCPU))
+			assert.Equal(t, tt.wantMemoryRequest, quantityOf(resources.Requests, corev1.ResourceMemory))
+			assert.Equal(t, tt.wantMemoryLimit, quantityOf(resources.Limits, corev1.ResourceMemory))
+			assert.Len(t, mutator.Summary().Clamps(), tt.wantClamps)
+		})
+	}
+}
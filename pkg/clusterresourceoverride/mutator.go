@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 
+	jsonpatch "gomodules.xyz/jsonpatch/v2"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/klog"
 )
@@ -34,32 +36,160 @@ type podMutator struct {
 	floor              *CPUMemory
 	ceiling            *CPUMemory
 	cpuBaseScaleFactor float64
+
+	// podFloor and podCeiling bound the effective requests and limits of the
+	// whole pod, they are optional.
+	podFloor   *CPUMemory
+	podCeiling *CPUMemory
+
+	// limitRequestRatio and podLimitRequestRatio are the maxLimitRequestRatio
+	// of the LimitRanges of containers and of pods, they are optional.
+	limitRequestRatio    *CPUMemory
+	podLimitRequestRatio *CPUMemory
+
+	// quota is what is left of the quotas of the namespace, it is optional.
+	quota quotaHeadroom
+
+	// nodeCeiling is the largest allocatable of the nodes the pod can be
+	// scheduled to, it is optional.
+	nodeCeiling *CPUMemory
+
+	// podLevel is true while the pod-level resources are overridden.
+	podLevel bool
+
+	// resizing is true while MutateResize runs.
+	resizing bool
+
+	// overhead is the overhead of the RuntimeClass of the pod.
+	overhead corev1.ResourceList
+
+	// namespace is the namespace of the pod, which the expressions of the
+	// rule the configuration was merged with read.
+	namespace *corev1.Namespace
+
+	// input holds what expressions are evaluated on, err the first error
+	// evaluating them, while Mutate runs.
+	input *expressionInput
+	err   error
+
+	// summary, current and operations are populated while Mutate runs.
+	summary    *MutationSummary
+	current    *ContainerMutation
+	operations []jsonpatch.Operation
+}
+
+// SetPodBounds sets the floor and ceiling of the effective requests and
+// limits of the pod, from the Pod LimitRanges of the namespace.
+func (m *podMutator) SetPodBounds(floor *CPUMemory, ceiling *CPUMemory) {
+	m.podFloor = floor
+	m.podCeiling = ceiling
+}
+
+// SetLimitRequestRatios sets the largest ratios of limit to request allowed
+// for containers and for pods, from the LimitRanges of the namespace.
+func (m *podMutator) SetLimitRequestRatios(container *CPUMemory, pod *CPUMemory) {
+	m.limitRequestRatio = container
+	m.podLimitRequestRatio = pod
+}
+
+// SetNamespace sets the namespace of the pod, which expressions read.
+func (m *podMutator) SetNamespace(namespace *corev1.Namespace) {
+	m.namespace = namespace
+}
+
+// Summary returns what the last call to Mutate did to the pod.
+func (m *podMutator) Summary() *MutationSummary {
+	return m.summary
 }
 
 func (m *podMutator) Mutate(in *corev1.Pod) (out *corev1.Pod, err error) {
 	current := in.DeepCopy()
+	m.summary = &MutationSummary{QoSBefore: podQOSClass(in)}
+	m.operations = nil
+	m.input = newExpressionInput(in, m.namespace)
+	m.err = nil
 
 	if m.config.ForceSelinuxRelabel {
 		m.OverrideForceSelinuxRelabel(current)
 	}
 
-	for i := range current.Spec.InitContainers {
-		m.Override(&current.Spec.InitContainers[i], current)
+	m.overridePod(in, current)
+	if m.err != nil {
+		err = m.err
+		return
 	}
+	m.summary.QoSAfter = podQOSClass(current)
 
-	for i := range current.Spec.Containers {
-		m.Override(&current.Spec.Containers[i], current)
+	if !equality.Semantic.DeepEqual(in.Spec.Resources, current.Spec.Resources) {
+		m.addOperation("/spec/resources", current.Spec.Resources.DeepCopy())
 	}
+	m.addResourcesOperations("/spec/initContainers", in.Spec.InitContainers, current.Spec.InitContainers)
+	m.addResourcesOperations("/spec/containers", in.Spec.Containers, current.Spec.Containers)
 
 	out = current
 	return
 }
 
+// overridePod overrides the resources of current, a copy of the pod in.
+func (m *podMutator) overridePod(in, current *corev1.Pod) {
+	if m.config.SkipResources {
+		klog.V(5).Infof("pod matches rule %s; skipping resource overrides", m.config.Rule)
+		return
+	}
+
+	if m.config.QoS.SkipGuaranteed && m.summary.QoSBefore == corev1.PodQOSGuaranteed {
+		klog.V(5).Infof("pod is %s; skipping resource overrides", corev1.PodQOSGuaranteed)
+		m.summary.QoSAction = QoSActionSkipped
+		return
+	}
+
+	if m.isOverheadHeavy(in) {
+		config, skip := m.config.ForOverheadHeavy()
+		m.summary.OverheadHeavy = true
+		if skip {
+			return
+		}
+
+		base := m.config
+		m.config = config
+		defer func() {
+			m.config = base
+		}()
+	}
+
+	for i := range current.Spec.InitContainers {
+		container := &current.Spec.InitContainers[i]
+		m.overrideClass(initContainerClass(container), container, current)
+	}
+
+	for i := range current.Spec.Containers {
+		m.overrideClass(ContainerClassRegular, &current.Spec.Containers[i], current)
+	}
+
+	if m.config.CapInitRequests {
+		m.CapInitRequests(current)
+	}
+
+	if current.Spec.Resources != nil {
+		m.OverridePodLevelResources(current)
+	}
+
+	m.OverridePodBounds(in, current)
+	m.PreserveQoS(in, current)
+
+	if m.config.QoS.WholeCoreCPU {
+		m.RoundExclusiveCPU(in, current)
+	}
+}
+
 const (
 	SpcType                      = "spc_t"
 	SelinuxRelabelResource       = "forceselinuxrelabel"
 	SelinuxRelabelGroup          = "admission.node.openshift.io"
 	OriginalCPURequestAnnotation = "clusterresourceoverrides.admission.autoscaling.openshift.io/original-cpu-request"
+
+	// OriginalPodCPURequestAnnotation holds the original pod-level CPU request.
+	OriginalPodCPURequestAnnotation = "clusterresourceoverrides.admission.autoscaling.openshift.io/original-pod-cpu-request"
 )
 
 var (
@@ -85,25 +215,83 @@ func (m *podMutator) OverrideForceSelinuxRelabel(pod *corev1.Pod) {
 		return
 	}
 	// PVC exists so modify the pod with the spc_t label
+	options := &corev1.SELinuxOptions{Type: SpcType}
 	if pod.Spec.SecurityContext == nil {
-		pod.Spec.SecurityContext = &corev1.PodSecurityContext{}
+		pod.Spec.SecurityContext = &corev1.PodSecurityContext{SELinuxOptions: options}
+		m.addOperation("/spec/securityContext", pod.Spec.SecurityContext.DeepCopy())
+		return
+	}
+
+	if !equality.Semantic.DeepEqual(pod.Spec.SecurityContext.SELinuxOptions, options) {
+		pod.Spec.SecurityContext.SELinuxOptions = options
+		m.addOperation("/spec/securityContext/seLinuxOptions", options.DeepCopy())
+	}
+}
+
+// addResourcesOperations records an operation for each container under path
+// whose resources changed.
+func (m *podMutator) addResourcesOperations(path string, before, after []corev1.Container) {
+	for i := range after {
+		if !equality.Semantic.DeepEqual(before[i].Resources, after[i].Resources) {
+			m.addOperation(fmt.Sprintf("%s/%d/resources", path, i), after[i].Resources.DeepCopy())
+		}
 	}
-	pod.Spec.SecurityContext.SELinuxOptions = &corev1.SELinuxOptions{Type: SpcType}
 }
 
 func (m *podMutator) Override(container *corev1.Container, current *corev1.Pod) {
+	mutation := m.overrideResources(container.Name, &container.Resources, current)
+	if m.summary != nil {
+		m.summary.Containers = append(m.summary.Containers, mutation)
+	}
+}
+
+// overrideResources applies the ratios to the given resources of the
+// container with the given name, or of the pod while podLevel is set.
+func (m *podMutator) overrideResources(name string, resources *corev1.ResourceRequirements, current *corev1.Pod) (mutation ContainerMutation) {
+	mutation = ContainerMutation{
+		Name:   name,
+		Before: *resources.DeepCopy(),
+	}
+	m.current = &mutation
+	defer func() {
+		m.current = nil
+		mutation.After = *resources.DeepCopy()
+	}()
+
 	// Needs to run before an override modifies the request
-	m.AnnotateOriginalRequest(&container.Resources, container.Name, current)
+	m.AnnotateOriginalRequest(resources, name, current)
+
+	// The overrides below start from the limits, requests are kept if their
+	// limit is derived from them.
+	derived := m.DeriveLimits(resources)
 
-	m.OverrideMemory(&container.Resources)
+	if !derived[corev1.ResourceMemory] {
+		m.OverrideMemory(resources)
+	}
 
 	// The order is important here, this is processed prior to overriding CPU request.
-	m.OverrideCPULimit(&container.Resources)
+	m.OverrideCPULimit(resources)
 
-	m.OverrideCPUWithLimit(&container.Resources)
+	if !derived[corev1.ResourceCPU] {
+		m.OverrideCPUWithLimit(resources)
+	}
 
 	// Should run after OverrideCPUWithLimit
-	m.OverrideCPUWithRequest(&container.Resources, container.Name, current)
+	m.OverrideCPUWithRequest(resources, name, current)
+
+	// Should run last, once the CPU request is final.
+	m.OverrideCPULimitMode(resources)
+	return
+}
+
+// originalRequestKey returns the annotation holding the original CPU request
+// of the container with the given name, or of the pod while podLevel is set.
+func (m *podMutator) originalRequestKey(name string) string {
+	if m.podLevel {
+		return OriginalPodCPURequestAnnotation
+	}
+
+	return fmt.Sprintf("%s-%s", OriginalCPURequestAnnotation, name)
 }
 
 // Annotates pod with original CPU request value. Annotation provides idempotency for
@@ -114,18 +302,20 @@ func (m *podMutator) AnnotateOriginalRequest(resources *corev1.ResourceRequireme
 		return
 	}
 
-	if pod.Annotations == nil {
-		pod.Annotations = map[string]string{}
-	}
-
-	key := fmt.Sprintf("%s-%s", OriginalCPURequestAnnotation, name)
+	key := m.originalRequestKey(name)
 	_, found := pod.Annotations[key]
 	if !found {
 		request := resources.Requests[corev1.ResourceCPU]
 		if request.IsZero() {
 			return
 		}
+
+		created := pod.Annotations == nil
+		if created {
+			pod.Annotations = map[string]string{}
+		}
 		pod.Annotations[key] = request.String()
+		m.addAnnotationOperation(pod, key, created)
 	}
 }
 
@@ -160,17 +350,7 @@ func (m *podMutator) OverrideMemory(resources *corev1.ResourceRequirements) {
 	}
 
 	overridden := resource.NewQuantity(int64(amount), limit.Format)
-	if m.IsMemoryFloorSpecified() && overridden.Cmp(*m.floor.Memory) < 0 {
-		klog.V(5).Infof("%s pod limit %q below namespace limit; setting limit to %q", corev1.ResourceMemory, overridden.String(), m.floor.Memory.String())
-		copy := m.floor.Memory.DeepCopy()
-		overridden = &copy
-	}
-
-	if m.IsMemoryCeilingSpecified() && overridden.Cmp(*m.ceiling.Memory) > 0 {
-		klog.V(5).Infof("%s pod limit %q above namespace limit; setting limit to %q", corev1.ResourceMemory, overridden.String(), m.ceiling.Memory.String())
-		copy := m.ceiling.Memory.DeepCopy()
-		overridden = &copy
-	}
+	overridden = m.clamp(corev1.ResourceMemory, FieldRequest, overridden)
 
 	ensureRequests(resources)
 	resources.Requests[corev1.ResourceMemory] = *overridden
@@ -192,19 +372,7 @@ func (m *podMutator) OverrideCPULimit(resources *corev1.ResourceRequirements) {
 
 	amount := float64(limit.Value()) * m.config.LimitCPUToMemoryRatio * m.cpuBaseScaleFactor
 	overridden := resource.NewMilliQuantity(int64(amount), resource.DecimalSI)
-	if m.IsCpuFloorSpecified() && overridden.Cmp(*m.floor.CPU) < 0 {
-		klog.V(5).Infof("%s pod limit %q below namespace limit; setting limit to %q", corev1.ResourceCPU, overridden.String(), m.floor.CPU.String())
-
-		clone := m.floor.CPU.DeepCopy()
-		overridden = &clone
-	}
-
-	if m.IsCpuCeilingSpecified() && overridden.Cmp(*m.ceiling.CPU) > 0 {
-		klog.V(5).Infof("%s pod limit %q above namespace limit; setting limit to %q", corev1.ResourceCPU, overridden.String(), m.ceiling.CPU.String())
-
-		clone := m.ceiling.CPU.DeepCopy()
-		overridden = &clone
-	}
+	overridden = m.clamp(corev1.ResourceCPU, FieldLimit, overridden)
 
 	ensureLimits(resources)
 	resources.Limits[corev1.ResourceCPU] = *overridden
@@ -224,18 +392,7 @@ func (m *podMutator) OverrideCPUWithLimit(resources *corev1.ResourceRequirements
 
 	amount := float64(limit.MilliValue()) * m.config.CpuRequestToLimitRatio
 	overridden := resource.NewMilliQuantity(int64(amount), limit.Format)
-
-	if m.IsCpuFloorSpecified() && overridden.Cmp(*m.floor.CPU) < 0 {
-		klog.V(5).Infof("%s pod request %q below namespace minimum; setting request to %q", corev1.ResourceCPU, overridden.String(), m.floor.CPU.String())
-		clone := m.floor.CPU.DeepCopy()
-		overridden = &clone
-	}
-
-	if m.IsCpuCeilingSpecified() && overridden.Cmp(*m.ceiling.CPU) > 0 {
-		klog.V(5).Infof("%s pod request %q above namespace maximum; setting request to %q", corev1.ResourceCPU, overridden.String(), m.ceiling.CPU.String())
-		clone := m.ceiling.CPU.DeepCopy()
-		overridden = &clone
-	}
+	overridden = m.clamp(corev1.ResourceCPU, FieldRequest, overridden)
 
 	ensureRequests(resources)
 	resources.Requests[corev1.ResourceCPU] = *overridden
@@ -248,7 +405,7 @@ func (m *podMutator) OverrideCPUWithRequest(resources *corev1.ResourceRequiremen
 		return
 	}
 
-	key := fmt.Sprintf("%s-%s", OriginalCPURequestAnnotation, name)
+	key := m.originalRequestKey(name)
 	strValue, found := pod.Annotations[key]
 	if !found {
 		klog.Warningf("failed to find %q annotation for pod %s/%s; skipping CPU request override", key, pod.Namespace, pod.Name)
@@ -265,23 +422,63 @@ func (m *podMutator) OverrideCPUWithRequest(resources *corev1.ResourceRequiremen
 		return
 	}
 
-	amount := float64(request.MilliValue()) * m.config.CpuRequestToRequestRatio
+	ratio := m.config.CpuRequestToRequestRatio
+	if m.resizing {
+		// the annotation holds the CPU request of the resize, see resizeContainer.
+		ratio = 1
+	}
+
+	amount := float64(request.MilliValue()) * ratio
 	overridden := resource.NewMilliQuantity(int64(amount), request.Format)
+	overridden = m.clamp(corev1.ResourceCPU, FieldRequest, overridden)
 
-	if m.IsCpuFloorSpecified() && overridden.Cmp(*m.floor.CPU) < 0 {
-		klog.V(5).Infof("%s pod request %q below namespace minimum; setting request to %q", corev1.ResourceCPU, overridden.String(), m.floor.CPU.String())
-		clone := m.floor.CPU.DeepCopy()
+	ensureRequests(resources)
+	resources.Requests[corev1.ResourceCPU] = *overridden
+}
+
+// clamp moves an overridden value of the given resource into the namespace
+// floor and ceiling, recording the adjustment for the container being mutated.
+func (m *podMutator) clamp(name corev1.ResourceName, field string, overridden *resource.Quantity) *resource.Quantity {
+	var floor, ceiling *resource.Quantity
+	floorBound, ceilingBound := BoundFloor, BoundCeiling
+	switch {
+	case m.podLevel:
+		// pod-level resources are bound by the Pod LimitRanges, which also
+		// count the overhead.
+		floor = m.withoutOverhead(boundQuantity(m.podFloor, name), name)
+		ceiling = m.withoutOverhead(boundQuantity(m.podCeiling, name), name)
+		floorBound, ceilingBound = BoundPodFloor, BoundPodCeiling
+	case name == corev1.ResourceCPU:
+		if m.IsCpuFloorSpecified() {
+			floor = m.floor.CPU
+		}
+		if m.IsCpuCeilingSpecified() {
+			ceiling = m.ceiling.CPU
+		}
+	case name == corev1.ResourceMemory:
+		if m.IsMemoryFloorSpecified() {
+			floor = m.floor.Memory
+		}
+		if m.IsMemoryCeilingSpecified() {
+			ceiling = m.ceiling.Memory
+		}
+	}
+
+	if floor != nil && overridden.Cmp(*floor) < 0 {
+		klog.V(5).Infof("%s pod %s %q below namespace minimum; setting %s to %q", name, field, overridden.String(), field, floor.String())
+		clone := floor.DeepCopy()
+		m.current.addClamp(name, field, floorBound, overridden, &clone)
 		overridden = &clone
 	}
 
-	if m.IsCpuCeilingSpecified() && overridden.Cmp(*m.ceiling.CPU) > 0 {
-		klog.V(5).Infof("%s pod request %q above namespace maximum; setting request to %q", corev1.ResourceCPU, overridden.String(), m.ceiling.CPU.String())
-		clone := m.ceiling.CPU.DeepCopy()
+	if ceiling != nil && overridden.Cmp(*ceiling) > 0 {
+		klog.V(5).Infof("%s pod %s %q above namespace maximum; setting %s to %q", name, field, overridden.String(), field, ceiling.String())
+		clone := ceiling.DeepCopy()
+		m.current.addClamp(name, field, ceilingBound, overridden, &clone)
 		overridden = &clone
 	}
 
-	ensureRequests(resources)
-	resources.Requests[corev1.ResourceCPU] = *overridden
+	return overridden
 }
 
 func (m *podMutator) IsCpuFloorSpecified() bool {
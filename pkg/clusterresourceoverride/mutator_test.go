@@ -183,6 +183,58 @@ func TestMutator_Mutate(t *testing.T) {
 	})
 }
 
+func TestMutator_Summary(t *testing.T) {
+	cpuFloor := resource.MustParse("300m")
+	memory := resource.MustParse("1Mi")
+
+	config := &Config{
+		CpuRequestToLimitRatio:    0.25,
+		MemoryRequestToLimitRatio: 0.5,
+	}
+	mutator, err := NewMutator(config, &CPUMemory{CPU: &cpuFloor, Memory: &memory}, &CPUMemory{}, factor)
+	require.NoError(t, err)
+
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "app",
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							corev1.ResourceMemory: resource.MustParse("2Gi"),
+							corev1.ResourceCPU:    resource.MustParse("1000m"),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	_, err = mutator.Mutate(pod)
+	require.NoError(t, err)
+
+	summary := mutator.Summary()
+	require.NotNil(t, summary)
+	require.Len(t, summary.Containers, 1)
+
+	mutation := summary.Containers[0]
+	assert.Equal(t, "app", mutation.Name)
+	assert.Empty(t, mutation.Before.Requests)
+	validate(t, mutation.After.Requests, corev1.ResourceMemory, resource.MustParse("1Gi"))
+	validate(t, mutation.After.Requests, corev1.ResourceCPU, resource.MustParse("300m"))
+
+	// 25% of 1000m is below the namespace floor of 300m.
+	assert.Equal(t, []Clamp{
+		{
+			Resource: corev1.ResourceCPU,
+			Field:    FieldRequest,
+			Bound:    BoundFloor,
+			From:     "250m",
+			To:       "300m",
+		},
+	}, summary.Clamps())
+}
+
 func TestMutator_OverrideMemory(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -1085,3 +1137,45 @@ func validate(t *testing.T, list corev1.ResourceList, name corev1.ResourceName,
 	result := got.Equal(want)
 	require.True(t, result, "mutated, expected: %v, got %v", want, got)
 }
+
+// newTestPod returns the pod foo/bar running the given containers.
+func newTestPod(containers ...corev1.Container) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "foo"},
+		Spec:       corev1.PodSpec{Containers: containers},
+	}
+}
+
+// newTestContainer returns a container with the given requests and limits.
+func newTestContainer(name, cpuRequest, cpuLimit, memoryRequest, memoryLimit string) corev1.Container {
+	return corev1.Container{Name: name, Resources: newTestResources(cpuRequest, cpuLimit, memoryRequest, memoryLimit)}
+}
+
+// newTestResources returns the given requests and limits, the empty
+// quantities are not set.
+func newTestResources(cpuRequest, cpuLimit, memoryRequest, memoryLimit string) corev1.ResourceRequirements {
+	resources := corev1.ResourceRequirements{Requests: corev1.ResourceList{}, Limits: corev1.ResourceList{}}
+	for _, value := range []struct {
+		list  corev1.ResourceList
+		name  corev1.ResourceName
+		value string
+	}{
+		{resources.Requests, corev1.ResourceCPU, cpuRequest},
+		{resources.Limits, corev1.ResourceCPU, cpuLimit},
+		{resources.Requests, corev1.ResourceMemory, memoryRequest},
+		{resources.Limits, corev1.ResourceMemory, memoryLimit},
+	} {
+		if value.value != "" {
+			value.list[value.name] = resource.MustParse(value.value)
+		}
+	}
+
+	return resources
+}
+
+// newTestSidecar returns the given container as a native sidecar.
+func newTestSidecar(container corev1.Container) corev1.Container {
+	always := corev1.ContainerRestartPolicyAlways
+	container.RestartPolicy = &always
+	return container
+}
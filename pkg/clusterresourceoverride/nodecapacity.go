@@ -0,0 +1,195 @@
+package clusterresourceoverride
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog"
+)
+
+// nodeCapacity returns the largest allocatable of the nodes pods can be
+// scheduled to. A nil nodeCapacity knows no nodes.
+type nodeCapacity struct {
+	nodes corev1listers.NodeLister
+}
+
+func newNodeCapacity(nodes corev1listers.NodeLister) *nodeCapacity {
+	return &nodeCapacity{
+		nodes: nodes,
+	}
+}
+
+// Largest returns the largest allocatable CPU and the largest allocatable
+// memory of the nodes that match the nodeSelector, the required node affinity
+// and the tolerations of the pod, nil if no node matches.
+func (c *nodeCapacity) Largest(pod *corev1.Pod) (largest *CPUMemory) {
+	if c == nil {
+		return
+	}
+
+	nodes, err := c.nodes.List(labels.Everything())
+	if err != nil {
+		klog.Warningf("namespace=%s failed to list nodes, not capping to node allocatable: %v", pod.Namespace, err)
+		return
+	}
+
+	for _, node := range nodes {
+		if !schedulableTo(pod, node) {
+			continue
+		}
+
+		if largest == nil {
+			largest = &CPUMemory{}
+		}
+		largest.CPU = largerQuantity(largest.CPU, node.Status.Allocatable, corev1.ResourceCPU)
+		largest.Memory = largerQuantity(largest.Memory, node.Status.Allocatable, corev1.ResourceMemory)
+	}
+
+	return
+}
+
+func largerQuantity(current *resource.Quantity, list corev1.ResourceList, name corev1.ResourceName) *resource.Quantity {
+	quantity, found := list[name]
+	if !found || (current != nil && current.Cmp(quantity) >= 0) {
+		return current
+	}
+
+	clone := quantity.DeepCopy()
+	return &clone
+}
+
+// schedulableTo returns true if the scheduler may place the pod on the node,
+// regardless of the resources already in use there.
+func schedulableTo(pod *corev1.Pod, node *corev1.Node) bool {
+	if pod.Spec.NodeName != "" {
+		return pod.Spec.NodeName == node.Name
+	}
+
+	if !labels.SelectorFromSet(pod.Spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false
+	}
+
+	if affinity := pod.Spec.Affinity; affinity != nil && affinity.NodeAffinity != nil && affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		if !matchesNodeSelector(affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution, node) {
+			return false
+		}
+	}
+
+	taints := node.Spec.Taints
+	if node.Spec.Unschedulable {
+		taints = append([]corev1.Taint{{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule}}, taints...)
+	}
+	for i := range taints {
+		taint := &taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+
+		if !tolerated(pod.Spec.Tolerations, taint) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesNodeSelector returns true if the node matches any of the terms.
+func matchesNodeSelector(nodeSelector *corev1.NodeSelector, node *corev1.Node) bool {
+	for i := range nodeSelector.NodeSelectorTerms {
+		term := &nodeSelector.NodeSelectorTerms[i]
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+
+		if matchesRequirements(term.MatchExpressions, labels.Set(node.Labels)) &&
+			matchesRequirements(term.MatchFields, labels.Set{metav1.ObjectNameField: node.Name}) {
+			return true
+		}
+	}
+
+	return false
+}
+
+var nodeSelectorOperators = map[corev1.NodeSelectorOperator]selection.Operator{
+	corev1.NodeSelectorOpIn:           selection.In,
+	corev1.NodeSelectorOpNotIn:        selection.NotIn,
+	corev1.NodeSelectorOpExists:       selection.Exists,
+	corev1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+	corev1.NodeSelectorOpGt:           selection.GreaterThan,
+	corev1.NodeSelectorOpLt:           selection.LessThan,
+}
+
+func matchesRequirements(requirements []corev1.NodeSelectorRequirement, set labels.Set) bool {
+	for _, requirement := range requirements {
+		operator, found := nodeSelectorOperators[requirement.Operator]
+		if !found {
+			return false
+		}
+
+		parsed, err := labels.NewRequirement(requirement.Key, operator, requirement.Values)
+		if err != nil || !parsed.Matches(set) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// tolerated returns true if one of the tolerations tolerates the taint.
+func tolerated(tolerations []corev1.Toleration, taint *corev1.Taint) bool {
+	for i := range tolerations {
+		toleration := &tolerations[i]
+		if toleration.Effect != "" && toleration.Effect != taint.Effect {
+			continue
+		}
+
+		if toleration.Key != "" && toleration.Key != taint.Key {
+			continue
+		}
+
+		switch toleration.Operator {
+		case "", corev1.TolerationOpEqual:
+			if toleration.Value == taint.Value {
+				return true
+			}
+		case corev1.TolerationOpExists:
+			return true
+		}
+	}
+
+	return false
+}
+
+// slimNode keeps the parts of nodes nodeCapacity reads, the status of nodes
+// is large and often updated.
+func slimNode(obj interface{}) (interface{}, error) {
+	node, ok := obj.(*corev1.Node)
+	if !ok {
+		return stripManagedFields(obj)
+	}
+
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            node.Name,
+			UID:             node.UID,
+			ResourceVersion: node.ResourceVersion,
+			Labels:          node.Labels,
+		},
+		Spec: corev1.NodeSpec{
+			Unschedulable: node.Spec.Unschedulable,
+			Taints:        node.Spec.Taints,
+		},
+		Status: corev1.NodeStatus{
+			Allocatable: node.Status.Allocatable,
+		},
+	}, nil
+}
+
+// SetNodeCapacity sets the largest allocatable of the nodes the pod can be
+// scheduled to, which bounds the values the overrides raise.
+func (m *podMutator) SetNodeCapacity(largest *CPUMemory) {
+	m.nodeCeiling = largest
+}
@@ -0,0 +1,127 @@
+package clusterresourceoverride
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestNode(name, cpu, memory string, nodeLabels map[string]string, taints ...corev1.Taint) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: nodeLabels},
+		Spec:       corev1.NodeSpec{Taints: taints},
+		Status: corev1.NodeStatus{Allocatable: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		}},
+	}
+}
+
+func TestSchedulableTo(t *testing.T) {
+	gpu := corev1.Taint{Key: "gpu", Value: "true", Effect: corev1.TaintEffectNoSchedule}
+	node := newTestNode("worker-0", "4", "16Gi", map[string]string{"pool": "gpu", "cores": "4"}, gpu)
+
+	affinity := func(key string, operator corev1.NodeSelectorOperator, values ...string) *corev1.Affinity {
+		return &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{
+				{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: key, Operator: operator, Values: values}}},
+			}},
+		}}
+	}
+	tolerations := []corev1.Toleration{{Key: "gpu", Operator: corev1.TolerationOpExists}}
+
+	tests := []struct {
+		name string
+		spec corev1.PodSpec
+		want bool
+	}{
+		{
+			name: "WithoutToleration",
+			spec: corev1.PodSpec{},
+		},
+		{
+			name: "WithToleration",
+			spec: corev1.PodSpec{Tolerations: tolerations},
+			want: true,
+		},
+		{
+			name: "WithNodeSelector",
+			spec: corev1.PodSpec{Tolerations: tolerations, NodeSelector: map[string]string{"pool": "gpu"}},
+			want: true,
+		},
+		{
+			name: "WithOtherNodeSelector",
+			spec: corev1.PodSpec{Tolerations: tolerations, NodeSelector: map[string]string{"pool": "infra"}},
+		},
+		{
+			name: "WithAffinity",
+			spec: corev1.PodSpec{Tolerations: tolerations, Affinity: affinity("cores", corev1.NodeSelectorOpGt, "2")},
+			want: true,
+		},
+		{
+			name: "WithOtherAffinity",
+			spec: corev1.PodSpec{Tolerations: tolerations, Affinity: affinity("pool", corev1.NodeSelectorOpNotIn, "gpu")},
+		},
+		{
+			name: "WithNodeName",
+			spec: corev1.PodSpec{NodeName: "worker-1", Tolerations: tolerations},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, schedulableTo(&corev1.Pod{Spec: tt.spec}, node))
+		})
+	}
+}
+
+func TestNodeCapacityLargest(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	require.NoError(t, indexer.Add(newTestNode("small", "2", "8Gi", nil)))
+	require.NoError(t, indexer.Add(newTestNode("large", "8", "32Gi", nil, corev1.Taint{Key: "dedicated", Effect: corev1.TaintEffectNoSchedule})))
+	cordoned := newTestNode("cordoned", "16", "64Gi", nil)
+	cordoned.Spec.Unschedulable = true
+	require.NoError(t, indexer.Add(cordoned))
+	capacity := newNodeCapacity(corev1listers.NewNodeLister(indexer))
+
+	largestGot := capacity.Largest(&corev1.Pod{})
+	require.NotNil(t, largestGot)
+	assert.Equal(t, "2", largestGot.CPU.String())
+	assert.Equal(t, "8Gi", largestGot.Memory.String())
+
+	largestGot = capacity.Largest(&corev1.Pod{Spec: corev1.PodSpec{Tolerations: []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}}}})
+	assert.Equal(t, "8", largestGot.CPU.String())
+
+	assert.Nil(t, capacity.Largest(&corev1.Pod{Spec: corev1.PodSpec{NodeSelector: map[string]string{"pool": "gpu"}}}))
+	assert.Nil(t, (*nodeCapacity)(nil).Largest(&corev1.Pod{}))
+}
+
+func TestMutateWithNodeCapacity(t *testing.T) {
+	quantity := func(value string) *resource.Quantity { q := resource.MustParse(value); return &q }
+
+	mutator, err := NewMutator(&Config{MemoryLimitToRequestRatio: 4}, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+	require.NoError(t, err)
+	mutator.SetNodeCapacity(&CPUMemory{CPU: quantity("4"), Memory: quantity("16Gi")})
+
+	// the derived limit of 32Gi fits on no node.
+	podGot, err := mutator.Mutate(newTestPod(newTestContainer("app", "", "", "8Gi", "")))
+	require.NoError(t, err)
+	assert.Equal(t, "16Gi", podGot.Spec.Containers[0].Resources.Limits.Memory().String())
+
+	clamps := mutator.Summary().Clamps()
+	require.Len(t, clamps, 1)
+	assert.Equal(t, BoundNode, clamps[0].Bound)
+	assert.Equal(t, "resource overrides were capped to the largest allocatable of the nodes the pod can be scheduled to: memory limit lowered to 16Gi", nodeCapacityWarning(clamps))
+
+	// limits are not lowered below the requests of the pod.
+	podGot, err = mutator.Mutate(newTestPod(newTestContainer("app", "", "", "32Gi", "")))
+	require.NoError(t, err)
+	assert.Equal(t, "32Gi", podGot.Spec.Containers[0].Resources.Limits.Memory().String())
+	assert.Equal(t, "32Gi", podGot.Spec.Containers[0].Resources.Requests.Memory().String())
+}
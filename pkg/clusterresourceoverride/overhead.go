@@ -0,0 +1,101 @@
+package clusterresourceoverride
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	nodev1listers "k8s.io/client-go/listers/node/v1"
+	"k8s.io/klog"
+)
+
+// overheadGetter returns the overhead the RuntimeClass of a pod adds to its
+// requests. A nil getter only reads the overhead already set on the pod.
+type overheadGetter struct {
+	runtimeClasses nodev1listers.RuntimeClassLister
+}
+
+func newOverheadGetter(runtimeClasses nodev1listers.RuntimeClassLister) *overheadGetter {
+	return &overheadGetter{
+		runtimeClasses: runtimeClasses,
+	}
+}
+
+// Get returns the overhead of the pod. The RuntimeClass admission plugin
+// usually sets it before webhooks are called, it is read from the
+// RuntimeClass of the pod otherwise. The pod is considered to have no
+// overhead if its RuntimeClass can not be read.
+func (g *overheadGetter) Get(pod *corev1.Pod) corev1.ResourceList {
+	if pod.Spec.Overhead != nil || pod.Spec.RuntimeClassName == nil || g == nil {
+		return pod.Spec.Overhead
+	}
+
+	runtimeClass, err := g.runtimeClasses.Get(*pod.Spec.RuntimeClassName)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.Warningf("namespace=%s failed to get RuntimeClass %s, ignoring its overhead: %v", pod.Namespace, *pod.Spec.RuntimeClassName, err)
+		}
+		return nil
+	}
+
+	if runtimeClass.Overhead == nil {
+		return nil
+	}
+
+	return runtimeClass.Overhead.PodFixed
+}
+
+// SetOverhead sets the overhead the RuntimeClass of the pod adds to its
+// requests, which counts towards the Pod LimitRanges.
+func (m *podMutator) SetOverhead(overhead corev1.ResourceList) {
+	m.overhead = overhead
+}
+
+// effectiveQuantity returns podQuantity plus the overhead of the pod, which
+// the scheduler and LimitRanger add to the requests and limits of a pod.
+func (m *podMutator) effectiveQuantity(pod *corev1.Pod, field string, name corev1.ResourceName) resource.Quantity {
+	quantity := podQuantity(pod, field, name)
+	if overhead, found := m.overhead[name]; found && !quantity.IsZero() {
+		quantity.Add(overhead)
+	}
+
+	return quantity
+}
+
+// withoutOverhead returns the pod bound of the given resource minus the
+// overhead, which is the bound of the pod-level resources.
+func (m *podMutator) withoutOverhead(bound *resource.Quantity, name corev1.ResourceName) *resource.Quantity {
+	overhead, found := m.overhead[name]
+	if bound == nil || !found {
+		return bound
+	}
+
+	remaining := bound.DeepCopy()
+	remaining.Sub(overhead)
+	if remaining.Sign() < 0 {
+		remaining = zeroQuantity(name)
+	}
+
+	return &remaining
+}
+
+// isOverheadHeavy returns true if the overhead of the pod is at least the
+// configured share of its CPU or memory requests.
+func (m *podMutator) isOverheadHeavy(pod *corev1.Pod) bool {
+	if m.config.OverheadHeavy == nil {
+		return false
+	}
+
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		overhead, found := m.overhead[name]
+		if !found {
+			continue
+		}
+
+		requests := podQuantity(pod, FieldRequest, name)
+		if !requests.IsZero() && overhead.AsApproximateFloat64() >= m.config.OverheadHeavy.ThresholdRatio*requests.AsApproximateFloat64() {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,135 @@
+package clusterresourceoverride
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	nodev1listers "k8s.io/client-go/listers/node/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestOverheadGetter(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	require.NoError(t, indexer.Add(&nodev1.RuntimeClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "kata"},
+		Handler:    "kata",
+		Overhead: &nodev1.Overhead{
+			PodFixed: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("160Mi")},
+		},
+	}))
+	getter := newOverheadGetter(nodev1listers.NewRuntimeClassLister(indexer))
+
+	runtimeClass := func(name string) *string { return &name }
+	tests := []struct {
+		name   string
+		getter *overheadGetter
+		pod    *corev1.Pod
+		want   string
+	}{
+		{
+			name:   "WithOverheadSet",
+			getter: getter,
+			pod: &corev1.Pod{Spec: corev1.PodSpec{
+				RuntimeClassName: runtimeClass("kata"),
+				Overhead:         corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("200Mi")},
+			}},
+			want: "200Mi",
+		},
+		{
+			name:   "WithRuntimeClass",
+			getter: getter,
+			pod:    &corev1.Pod{Spec: corev1.PodSpec{RuntimeClassName: runtimeClass("kata")}},
+			want:   "160Mi",
+		},
+		{
+			name:   "WithUnknownRuntimeClass",
+			getter: getter,
+			pod:    &corev1.Pod{Spec: corev1.PodSpec{RuntimeClassName: runtimeClass("gvisor")}},
+		},
+		{
+			name: "WithoutGetter",
+			pod:  &corev1.Pod{Spec: corev1.PodSpec{RuntimeClassName: runtimeClass("kata")}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overheadGot := tt.getter.Get(tt.pod)
+			if tt.want == "" {
+				assert.Empty(t, overheadGot)
+				return
+			}
+			assert.Equal(t, tt.want, overheadGot.Memory().String())
+		})
+	}
+}
+
+func TestMutateWithOverhead(t *testing.T) {
+	quantity := func(value string) *resource.Quantity { q := resource.MustParse(value); return &q }
+	overhead := corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")}
+
+	t.Run("WithPodFloor", func(t *testing.T) {
+		mutator, err := NewMutator(&Config{MemoryRequestToLimitRatio: 0.5}, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+		require.NoError(t, err)
+		mutator.SetPodBounds(&CPUMemory{Memory: quantity("1536Mi")}, nil)
+		mutator.SetOverhead(overhead)
+
+		pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{
+			newTestContainer("a", "1", "1", "1Gi", "1Gi"),
+			newTestContainer("b", "1", "1", "1Gi", "1Gi"),
+		}}}
+
+		// 2 x 512Mi plus the overhead reach the floor.
+		podGot, err := mutator.Mutate(pod)
+		require.NoError(t, err)
+		assert.Equal(t, "512Mi", podGot.Spec.Containers[0].Resources.Requests.Memory().String())
+		assert.Empty(t, mutator.Summary().Clamps())
+	})
+
+	t.Run("WithPodLevelResources", func(t *testing.T) {
+		mutator, err := NewMutator(&Config{MemoryRequestToLimitRatio: 0.5}, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+		require.NoError(t, err)
+		mutator.SetPodBounds(&CPUMemory{Memory: quantity("1792Mi")}, nil)
+		mutator.SetOverhead(overhead)
+
+		pod := newTestPod(newTestContainer("app", "", "", "", ""))
+		resources := newTestResources("1", "", "2Gi", "2Gi")
+		pod.Spec.Resources = &resources
+
+		podGot, err := mutator.Mutate(pod)
+		require.NoError(t, err)
+		assert.Equal(t, "1280Mi", podGot.Spec.Resources.Requests.Memory().String())
+	})
+
+	t.Run("WithOverheadHeavyPodSkipped", func(t *testing.T) {
+		config := &Config{
+			MemoryRequestToLimitRatio: 0.5,
+			OverheadHeavy:             &OverheadConfig{ThresholdRatio: 0.25, ClassConfig: ClassConfig{Skip: true}},
+		}
+		mutator, err := NewMutator(config, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+		require.NoError(t, err)
+		mutator.SetOverhead(overhead)
+
+		pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{
+			newTestContainer("a", "1", "1", "1Gi", "1Gi"),
+		}}}
+
+		podGot, err := mutator.Mutate(pod)
+		require.NoError(t, err)
+		assert.Equal(t, "1Gi", podGot.Spec.Containers[0].Resources.Requests.Memory().String())
+		assert.True(t, mutator.Summary().OverheadHeavy)
+		assert.Empty(t, mutator.Operations())
+
+		// pods with a small overhead are overridden.
+		mutator.SetOverhead(corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")})
+		podGot, err = mutator.Mutate(pod)
+		require.NoError(t, err)
+		assert.Equal(t, "512Mi", podGot.Spec.Containers[0].Resources.Requests.Memory().String())
+		assert.False(t, mutator.Summary().OverheadHeavy)
+	})
+}
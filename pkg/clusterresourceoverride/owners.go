@@ -0,0 +1,79 @@
+package clusterresourceoverride
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+// ownerGetter returns the kinds of the controllers of a pod. Pods of a
+// Deployment or a CronJob are controlled by a ReplicaSet or a Job, whose
+// metadata is read from the given indexers to find the workload above them.
+// A nil indexer, or a nil getter, only reads the controller of the pod.
+type ownerGetter struct {
+	replicaSets cache.Indexer
+	jobs        cache.Indexer
+}
+
+func newOwnerGetter(replicaSets, jobs cache.Indexer) *ownerGetter {
+	return &ownerGetter{
+		replicaSets: replicaSets,
+		jobs:        jobs,
+	}
+}
+
+// Kinds returns the kind of the controller of the pod, followed by the kind
+// of the controller of that controller if it is known.
+func (g *ownerGetter) Kinds(namespace string, pod *corev1.Pod) []string {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return nil
+	}
+
+	kinds := []string{owner.Kind}
+	indexer := g.indexerFor(owner)
+	if indexer == nil {
+		return kinds
+	}
+
+	obj, exists, err := indexer.GetByKey(namespace + "/" + owner.Name)
+	if err != nil || !exists {
+		klog.V(3).Infof("namespace=%s %s %s is not cached, matching rules on its kind only: %v", namespace, owner.Kind, owner.Name, err)
+		return kinds
+	}
+
+	object, ok := obj.(metav1.Object)
+	if !ok || object.GetUID() != owner.UID {
+		return kinds
+	}
+
+	if parent := metav1.GetControllerOf(object); parent != nil {
+		kinds = append(kinds, parent.Kind)
+	}
+
+	return kinds
+}
+
+func (g *ownerGetter) indexerFor(owner *metav1.OwnerReference) cache.Indexer {
+	if g == nil {
+		return nil
+	}
+
+	gv, err := schema.ParseGroupVersion(owner.APIVersion)
+	if err != nil {
+		return nil
+	}
+
+	switch gv.WithKind(owner.Kind).GroupKind() {
+	case appsv1.SchemeGroupVersion.WithKind("ReplicaSet").GroupKind():
+		return g.replicaSets
+	case batchv1.SchemeGroupVersion.WithKind("Job").GroupKind():
+		return g.jobs
+	}
+
+	return nil
+}
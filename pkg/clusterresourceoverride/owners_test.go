@@ -0,0 +1,92 @@
+package clusterresourceoverride
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newTestReplicaSetMetadata returns the metadata of a ReplicaSet controlled
+// by the given Deployment.
+func newTestReplicaSetMetadata(name, deployment string) *metav1.PartialObjectMetadata {
+	controller := true
+	return &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "foo",
+		Name:      name,
+		UID:       types.UID("ReplicaSet/" + name),
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "apps/v1", Kind: "Deployment", Name: deployment, UID: types.UID("Deployment/" + deployment), Controller: &controller},
+		},
+	}}
+}
+
+func TestOwnerGetterKinds(t *testing.T) {
+	replicaSets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	require.NoError(t, replicaSets.Add(newTestReplicaSetMetadata("web-5d8f", "web")))
+	require.NoError(t, replicaSets.Add(newTestReplicaSetMetadata("stale", "web")))
+
+	tests := []struct {
+		name   string
+		getter *ownerGetter
+		owner  *metav1.OwnerReference
+		want   []string
+	}{
+		{
+			name:   "WithoutController",
+			getter: newOwnerGetter(replicaSets, nil),
+		},
+		{
+			name:   "WithStatefulSet",
+			getter: newOwnerGetter(replicaSets, nil),
+			owner:  &metav1.OwnerReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "db"},
+			want:   []string{"StatefulSet"},
+		},
+		{
+			name:   "WithReplicaSetOfDeployment",
+			getter: newOwnerGetter(replicaSets, nil),
+			owner:  &metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-5d8f", UID: "ReplicaSet/web-5d8f"},
+			want:   []string{"ReplicaSet", "Deployment"},
+		},
+		{
+			name:   "WithReplicaSetOfOtherUID",
+			getter: newOwnerGetter(replicaSets, nil),
+			owner:  &metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "stale", UID: "other"},
+			want:   []string{"ReplicaSet"},
+		},
+		{
+			name:   "WithReplicaSetNotCached",
+			getter: newOwnerGetter(replicaSets, nil),
+			owner:  &metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "api-7c9b", UID: "ReplicaSet/api-7c9b"},
+			want:   []string{"ReplicaSet"},
+		},
+		{
+			name:   "WithReplicaSetOfOtherGroup",
+			getter: newOwnerGetter(replicaSets, nil),
+			owner:  &metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "ReplicaSet", Name: "web-5d8f", UID: "ReplicaSet/web-5d8f"},
+			want:   []string{"ReplicaSet"},
+		},
+		{
+			name:  "WithNilGetter",
+			owner: &metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-5d8f", UID: "ReplicaSet/web-5d8f"},
+			want:  []string{"ReplicaSet"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{}
+			if tt.owner != nil {
+				controller := true
+				tt.owner.Controller = &controller
+				pod.OwnerReferences = []metav1.OwnerReference{*tt.owner}
+			}
+
+			assert.Equal(t, tt.want, tt.getter.Kinds("foo", pod))
+		})
+	}
+}
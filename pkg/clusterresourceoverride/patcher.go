@@ -2,34 +2,55 @@ package clusterresourceoverride
 
 import (
 	"encoding/json"
+	"strings"
 
 	jsonpatch "gomodules.xyz/jsonpatch/v2"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/runtime"
 )
 
-// Patch takes 2 byte arrays and returns a new response with json patch.
-// The original object should be passed in as raw bytes to avoid the roundtripping problem
-// described in https://github.com/kubernetes-sigs/kubebuilder/issues/510.
-func Patch(original runtime.RawExtension, mutated *corev1.Pod) (patches []byte, err error) {
-	current, marshalErr := json.Marshal(mutated)
-	if marshalErr != nil {
-		err = marshalErr
-		return
-	}
+const (
+	// patchOpAdd replaces the target member if it exists and creates it otherwise.
+	patchOpAdd = "add"
+)
 
-	operations, patchErr := jsonpatch.CreatePatch(original.Raw, current)
-	if patchErr != nil {
-		err = patchErr
-		return
+// Patch returns the JSON patch made of the given operations.
+func Patch(operations []jsonpatch.Operation) (patches []byte, err error) {
+	if operations == nil {
+		operations = []jsonpatch.Operation{}
 	}
 
-	patchBytes, marshalErr := json.Marshal(operations)
-	if marshalErr != nil {
-		err = marshalErr
+	patches, err = json.Marshal(operations)
+	return
+}
+
+// Operations returns the JSON patch operations that turn the pod passed to
+// the last call to Mutate into the pod it returned.
+func (m *podMutator) Operations() []jsonpatch.Operation {
+	return m.operations
+}
+
+// addOperation records that the member at path was set to value. value must
+// not be modified afterwards.
+func (m *podMutator) addOperation(path string, value interface{}) {
+	m.operations = append(m.operations, jsonpatch.Operation{
+		Operation: patchOpAdd,
+		Path:      path,
+		Value:     value,
+	})
+}
+
+// addAnnotationOperation records that the annotation key was set on a pod
+// that had no annotations if created is true.
+func (m *podMutator) addAnnotationOperation(pod *corev1.Pod, key string, created bool) {
+	if created {
+		m.addOperation("/metadata/annotations", map[string]string{key: pod.Annotations[key]})
 		return
 	}
 
-	patches = patchBytes
-	return
+	m.addOperation("/metadata/annotations/"+escapePathSegment(key), pod.Annotations[key])
+}
+
+// escapePathSegment escapes a reference token of a JSON pointer, see RFC 6901.
+func escapePathSegment(segment string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(segment, "~", "~0"), "/", "~1")
 }
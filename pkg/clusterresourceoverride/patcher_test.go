@@ -0,0 +1,210 @@
+package clusterresourceoverride
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	jsonpatch "gomodules.xyz/jsonpatch/v2"
+	evanjsonpatch "gopkg.in/evanphx/json-patch.v4"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// diffPatch returns the JSON patch that turns the original pod into the
+// mutated one by diffing the whole pod, as the webhook did before the mutator
+// recorded targeted operations. The original object is passed in as raw bytes
+// to avoid the roundtripping problem described in
+// https://github.com/kubernetes-sigs/kubebuilder/issues/510.
+func diffPatch(original runtime.RawExtension, mutated *corev1.Pod) ([]byte, error) {
+	current, err := json.Marshal(mutated)
+	if err != nil {
+		return nil, err
+	}
+
+	operations, err := jsonpatch.CreatePatch(original.Raw, current)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(operations)
+}
+
+// rawPod returns the pod as the API server would send it, with a field this
+// version of the API does not know about.
+func rawPod(t testing.TB, pod *corev1.Pod) []byte {
+	raw, err := json.Marshal(pod)
+	require.NoError(t, err)
+
+	object := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(raw, &object))
+	object["spec"].(map[string]interface{})["futureField"] = map[string]interface{}{"enabled": true}
+
+	raw, err = json.Marshal(object)
+	require.NoError(t, err)
+	return raw
+}
+
+// withoutPaths removes the members the webhook is allowed to change.
+func withoutPaths(t *testing.T, raw []byte) map[string]interface{} {
+	object := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(raw, &object))
+
+	delete(object["metadata"].(map[string]interface{}), "annotations")
+	spec := object["spec"].(map[string]interface{})
+	delete(spec, "securityContext")
+	for _, key := range []string{"initContainers", "containers"} {
+		containers, _ := spec[key].([]interface{})
+		for _, container := range containers {
+			delete(container.(map[string]interface{}), "resources")
+		}
+	}
+
+	return object
+}
+
+func TestMutatorOperations(t *testing.T) {
+	config := &Config{
+		LimitCPUToMemoryRatio:     2,
+		CpuRequestToLimitRatio:    0.25,
+		MemoryRequestToLimitRatio: 0.5,
+		CpuRequestToRequestRatio:  0.5,
+		ForceSelinuxRelabel:       true,
+	}
+
+	tests := []struct {
+		name            string
+		annotations     map[string]string
+		securityContext *corev1.PodSecurityContext
+	}{
+		{
+			name: "WithoutAnnotationsOrSecurityContext",
+		},
+		{
+			name:        "WithAnnotationsAndSecurityContext",
+			annotations: map[string]string{"a/b~c": "d"},
+			securityContext: &corev1.PodSecurityContext{
+				RunAsNonRoot:   func() *bool { b := true; return &b }(),
+				SELinuxOptions: &corev1.SELinuxOptions{Level: "s0"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newTestPod(
+				newTestContainer("container-0", "500m", "", "", "1Gi"),
+				newTestContainer("container-1", "500m", "", "", ""),
+				newTestContainer("container-2", "500m", "", "", "1Gi"),
+			)
+			pod.Labels = map[string]string{SelinuxFixEnabledLabelName: "true"}
+			pod.Annotations = tt.annotations
+			pod.Spec.SecurityContext = tt.securityContext
+			pod.Spec.Volumes = []corev1.Volume{
+				{
+					Name:         "data",
+					VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}},
+				},
+			}
+			pod.Spec.InitContainers = []corev1.Container{newTestContainer("init", "", "", "", "256Mi")}
+			raw := rawPod(t, pod)
+
+			mutator, err := NewMutator(config, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+			require.NoError(t, err)
+			mutated, err := mutator.Mutate(pod)
+			require.NoError(t, err)
+
+			patch, err := Patch(mutator.Operations())
+			require.NoError(t, err)
+
+			for _, operation := range mutator.Operations() {
+				assert.Truef(t, strings.HasPrefix(operation.Path, "/metadata/annotations") ||
+					strings.HasPrefix(operation.Path, "/spec/securityContext") ||
+					strings.HasSuffix(operation.Path, "/resources"), "unexpected path %s", operation.Path)
+			}
+
+			decoded, err := evanjsonpatch.DecodePatch(patch)
+			require.NoError(t, err)
+			patched, err := decoded.Apply(raw)
+			require.NoError(t, err)
+
+			// the patch produces the mutated pod ...
+			patchedPod := &corev1.Pod{}
+			require.NoError(t, json.Unmarshal(patched, patchedPod))
+			assert.True(t, equality.Semantic.DeepEqual(mutated, patchedPod), "patched pod differs from the mutated pod")
+
+			// ... and touches nothing else, not even fields unknown to the webhook.
+			assert.Equal(t, withoutPaths(t, raw), withoutPaths(t, patched))
+		})
+	}
+}
+
+func TestMutatorOperationsOnReinvocation(t *testing.T) {
+	config := &Config{
+		LimitCPUToMemoryRatio:     2,
+		CpuRequestToLimitRatio:    0.25,
+		MemoryRequestToLimitRatio: 0.5,
+		ForceSelinuxRelabel:       true,
+	}
+
+	pod := newTestPod(newTestContainer("container-0", "500m", "", "", "1Gi"), newTestContainer("container-1", "500m", "", "", ""))
+	pod.Spec.InitContainers = []corev1.Container{newTestContainer("init", "", "", "", "256Mi")}
+
+	mutator, err := NewMutator(config, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+	require.NoError(t, err)
+	mutated, err := mutator.Mutate(pod)
+	require.NoError(t, err)
+	require.NotEmpty(t, mutator.Operations())
+
+	_, err = mutator.Mutate(mutated)
+	require.NoError(t, err)
+	assert.Empty(t, mutator.Operations())
+
+	patch, err := Patch(mutator.Operations())
+	require.NoError(t, err)
+	assert.Equal(t, "[]", string(patch))
+}
+
+func BenchmarkPatch(b *testing.B) {
+	config := &Config{
+		LimitCPUToMemoryRatio:     2,
+		CpuRequestToLimitRatio:    0.25,
+		MemoryRequestToLimitRatio: 0.5,
+	}
+
+	for _, containers := range []int{1, 10, 50} {
+		pod := newTestPod()
+		for i := 0; i < containers; i++ {
+			pod.Spec.Containers = append(pod.Spec.Containers, newTestContainer(fmt.Sprintf("container-%d", i), "500m", "", "", "1Gi"))
+		}
+		original := runtime.RawExtension{Raw: rawPod(b, pod)}
+
+		b.Run(fmt.Sprintf("Diff/%d", containers), func(b *testing.B) {
+			mutator, _ := NewMutator(config, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				mutated, _ := mutator.Mutate(pod)
+				if _, err := diffPatch(original, mutated); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("Targeted/%d", containers), func(b *testing.B) {
+			mutator, _ := NewMutator(config, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _ = mutator.Mutate(pod)
+				if _, err := Patch(mutator.Operations()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
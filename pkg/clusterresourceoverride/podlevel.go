@@ -0,0 +1,46 @@
+package clusterresourceoverride
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// OverridePodLevelResources applies the ratios to the pod-level resources,
+// which bound the resources shared by all containers of the pod. Pod-level
+// values are clamped to the Pod LimitRanges of the namespace, and pod-level
+// requests are kept at or above the effective requests of the containers.
+func (m *podMutator) OverridePodLevelResources(pod *corev1.Pod) {
+	m.podLevel = true
+	defer func() {
+		m.podLevel = false
+	}()
+
+	resources := pod.Spec.Resources
+	mutation := m.overrideResources("", resources, pod)
+
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		request, found := resources.Requests[name]
+		if !found {
+			continue
+		}
+
+		containers := containersQuantity(pod, FieldRequest, name)
+		if request.Cmp(containers) >= 0 {
+			continue
+		}
+
+		// the API server rejects pod-level requests below those of the containers.
+		raised := containers.DeepCopy()
+		if limit, found := resources.Limits[name]; found && raised.Cmp(limit) > 0 {
+			raised = limit.DeepCopy()
+		}
+
+		klog.V(5).Infof("%s pod-level request %q below the requests of the containers; setting request to %q", name, request.String(), raised.String())
+		resources.Requests[name] = raised
+	}
+
+	mutation.After = *resources.DeepCopy()
+	if m.summary != nil {
+		m.summary.Pod = &mutation
+	}
+}
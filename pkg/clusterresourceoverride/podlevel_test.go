@@ -0,0 +1,78 @@
+package clusterresourceoverride
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestOverridePodLevelResources(t *testing.T) {
+	config := &Config{
+		LimitCPUToMemoryRatio:     1,
+		CpuRequestToLimitRatio:    0.25,
+		MemoryRequestToLimitRatio: 0.5,
+		CpuRequestToRequestRatio:  0.5,
+	}
+
+	tests := []struct {
+		name                   string
+		containerMemoryRequest string
+		podFloor               *CPUMemory
+		memoryRequest          string
+		clamps                 int
+	}{
+		{
+			name:          "WithPodLevelResources",
+			memoryRequest: "1Gi",
+		},
+		{
+			name:                   "WithContainersRequestingMore",
+			containerMemoryRequest: "1536Mi",
+			memoryRequest:          "1536Mi",
+		},
+		{
+			name:          "WithPodFloor",
+			podFloor:      &CPUMemory{Memory: func() *resource.Quantity { q := resource.MustParse("1280Mi"); return &q }()},
+			memoryRequest: "1280Mi",
+			clamps:        1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newTestPod(newTestContainer("app", "", "", tt.containerMemoryRequest, ""))
+			podResources := newTestResources("1", "", "2Gi", "2Gi")
+			pod.Spec.Resources = &podResources
+
+			mutator, err := NewMutator(config, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+			require.NoError(t, err)
+			mutator.SetPodBounds(tt.podFloor, nil)
+
+			podGot, err := mutator.Mutate(pod)
+			require.NoError(t, err)
+
+			resources := podGot.Spec.Resources
+			assert.Equal(t, tt.memoryRequest, resources.Requests.Memory().String())
+			assert.Equal(t, "2", resources.Limits.Cpu().String())
+			assert.Equal(t, "500m", resources.Requests.Cpu().String())
+			assert.Equal(t, "1", podGot.Annotations[OriginalPodCPURequestAnnotation])
+
+			summary := mutator.Summary()
+			require.NotNil(t, summary.Pod)
+			assert.Equal(t, *pod.Spec.Resources, summary.Pod.Before)
+			assert.Equal(t, *resources, summary.Pod.After)
+			assert.Len(t, summary.Clamps(), tt.clamps)
+
+			paths := []string{}
+			for _, operation := range mutator.Operations() {
+				paths = append(paths, operation.Path)
+			}
+			assert.Contains(t, paths, "/spec/resources")
+
+			// the containers of the pod are left as they are.
+			assert.Equal(t, pod.Spec.Containers[0].Resources, podGot.Spec.Containers[0].Resources)
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package clusterresourceoverride
+
+import (
+	"math"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog"
+)
+
+// podBoundsAttempts bounds the number of times the containers of a pod are
+// scaled to move it into the pod floor or ceiling. Containers that are skipped
+// or capped by their limit keep the first attempts from reaching the bound.
+const podBoundsAttempts = 3
+
+// podQuantity returns the amount of the given resource the pod needs for the
+// given field, the way the scheduler and LimitRanger compute it: the
+// pod-level value if set, the amount its containers need otherwise.
+func podQuantity(pod *corev1.Pod, field string, name corev1.ResourceName) resource.Quantity {
+	if pod.Spec.Resources != nil {
+		if quantity, found := resourceList(pod.Spec.Resources, field)[name]; found {
+			return quantity.DeepCopy()
+		}
+	}
+
+	return containersQuantity(pod, field, name)
+}
+
+// containersQuantity returns the amount of the given resource the containers
+// of the pod need for the given field: the sum over the regular containers and
+// native sidecars or, if larger, the largest amount needed while an init
+// container runs alongside the sidecars started before it. Containers without
+// a value for the field don't count.
+func containersQuantity(pod *corev1.Pod, field string, name corev1.ResourceName) resource.Quantity {
+	steady := zeroQuantity(name)
+	sidecars := zeroQuantity(name)
+	init := zeroQuantity(name)
+
+	for i := range pod.Spec.InitContainers {
+		container := &pod.Spec.InitContainers[i]
+		quantity, found := resourceList(&container.Resources, field)[name]
+		if !found {
+			quantity = zeroQuantity(name)
+		}
+
+		running := sidecars.DeepCopy()
+		running.Add(quantity)
+		if isSidecar(container) {
+			steady.Add(quantity)
+			sidecars = running.DeepCopy()
+		}
+
+		if running.Cmp(init) > 0 {
+			init = running
+		}
+	}
+
+	for i := range pod.Spec.Containers {
+		if quantity, found := resourceList(&pod.Spec.Containers[i].Resources, field)[name]; found {
+			steady.Add(quantity)
+		}
+	}
+
+	if init.Cmp(steady) > 0 {
+		return init
+	}
+
+	return steady
+}
+
+// CapInitRequests lowers the requests of the overridden init containers of
+// the pod to the sum of the requests of its regular containers. An init
+// container then needs no more than the regular containers, even with the
+// sidecars started before it running alongside, so it does not decide the
+// effective requests of the pod.
+func (m *podMutator) CapInitRequests(pod *corev1.Pod) {
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		containers := zeroQuantity(name)
+		for i := range pod.Spec.Containers {
+			if quantity, found := pod.Spec.Containers[i].Resources.Requests[name]; found {
+				containers.Add(quantity)
+			}
+		}
+
+		// there is nothing to cap at.
+		if containers.IsZero() {
+			continue
+		}
+
+		for i := range pod.Spec.InitContainers {
+			container := &pod.Spec.InitContainers[i]
+			mutation := m.summary.container(container.Name)
+			if isSidecar(container) || mutation == nil {
+				continue
+			}
+
+			request, found := container.Resources.Requests[name]
+			if !found || request.Cmp(containers) <= 0 {
+				continue
+			}
+
+			klog.V(5).Infof("%s init container %s request %q above the regular containers; setting request to %q", name, container.Name, request.String(), containers.String())
+			container.Resources.Requests[name] = containers.DeepCopy()
+			mutation.After = *container.Resources.DeepCopy()
+		}
+	}
+}
+
+// OverridePodBounds keeps the pod within the floor and ceiling of the Pod
+// LimitRanges of the namespace, which apply to the effective requests and
+// limits of the pod. Only values the overrides moved out of a bound are
+// moved back, by scaling the containers that were overridden, and never past
+// the value the pod had before the overrides.
+func (m *podMutator) OverridePodBounds(original, pod *corev1.Pod) {
+	// limits go first, raising a request may be capped by the limit.
+	for _, field := range []string{FieldLimit, FieldRequest} {
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			m.overridePodBound(original, pod, field, name)
+		}
+	}
+}
+
+func (m *podMutator) overridePodBound(original, pod *corev1.Pod, field string, name corev1.ResourceName) {
+	floor := boundQuantity(m.podFloor, name)
+	ceiling, ceilingBound := m.lowestPodCeiling(field, name)
+	if floor == nil && ceiling == nil {
+		return
+	}
+
+	// pod-level values are clamped when they are overridden.
+	if pod.Spec.Resources != nil {
+		if _, found := resourceList(pod.Spec.Resources, field)[name]; found {
+			return
+		}
+	}
+
+	before := m.effectiveQuantity(original, field, name)
+	for i := 0; i < podBoundsAttempts; i++ {
+		after := m.effectiveQuantity(pod, field, name)
+		if after.IsZero() {
+			return
+		}
+
+		var target resource.Quantity
+		var bound string
+		switch {
+		case floor != nil && after.Cmp(*floor) < 0 && after.Cmp(before) < 0:
+			target, bound = *floor, BoundPodFloor
+			if before.Cmp(target) < 0 {
+				target = before
+			}
+		case ceiling != nil && after.Cmp(*ceiling) > 0 && after.Cmp(before) > 0:
+			target, bound = *ceiling, ceilingBound
+			if before.Cmp(target) > 0 {
+				target = before
+			}
+			// lowering a limit also lowers the requests above it.
+			if field == FieldLimit {
+				if request := m.effectiveQuantity(original, FieldRequest, name); request.Cmp(target) > 0 {
+					target = request
+				}
+			}
+		default:
+			return
+		}
+
+		// the overhead does not scale with the containers.
+		overhead := m.overhead[name]
+		factor := (target.AsApproximateFloat64() - overhead.AsApproximateFloat64()) / (after.AsApproximateFloat64() - overhead.AsApproximateFloat64())
+		if factor <= 0 || math.IsInf(factor, 0) || math.IsNaN(factor) {
+			return
+		}
+
+		klog.V(5).Infof("%s pod %s %q outside of the namespace pod %s; scaling containers to %q", name, field, after.String(), bound, target.String())
+		if !m.scalePod(pod, field, name, bound, factor) {
+			return
+		}
+	}
+}
+
+// lowestPodCeiling returns the lowest of the ceilings of the given value of
+// the pod, and the bound it comes from.
+func (m *podMutator) lowestPodCeiling(field string, name corev1.ResourceName) (ceiling *resource.Quantity, bound string) {
+	ceiling, bound = boundQuantity(m.podCeiling, name), BoundPodCeiling
+	for _, other := range []struct {
+		ceiling *resource.Quantity
+		bound   string
+	}{
+		{m.quotaCeiling(field, name), BoundQuota},
+		{boundQuantity(m.nodeCeiling, name), BoundNode},
+	} {
+		if other.ceiling != nil && (ceiling == nil || other.ceiling.Cmp(*ceiling) < 0) {
+			ceiling, bound = other.ceiling, other.bound
+		}
+	}
+
+	return
+}
+
+// scalePod multiplies the given value of the overridden containers of the pod
+// by factor, keeping requests at or below limits. It returns false if no
+// value changed.
+func (m *podMutator) scalePod(pod *corev1.Pod, field string, name corev1.ResourceName, bound string, factor float64) (scaled bool) {
+	for _, container := range podContainers(pod) {
+		mutation := m.summary.container(container.Name)
+		if mutation == nil {
+			continue
+		}
+
+		resources := &container.Resources
+		list := resourceList(resources, field)
+		quantity, found := list[name]
+		if !found || quantity.IsZero() {
+			continue
+		}
+
+		overridden := scaleQuantity(quantity, name, factor, bound == BoundPodFloor)
+		if limit, found := resources.Limits[name]; found && field == FieldRequest && overridden.Cmp(limit) > 0 {
+			overridden = limit.DeepCopy()
+		}
+		if overridden.Cmp(quantity) == 0 {
+			continue
+		}
+
+		list[name] = overridden
+		if request, found := resources.Requests[name]; found && field == FieldLimit && request.Cmp(overridden) > 0 {
+			resources.Requests[name] = overridden.DeepCopy()
+		}
+
+		mutation.addClamp(name, field, bound, &quantity, &overridden)
+		mutation.After = *resources.DeepCopy()
+		scaled = true
+	}
+
+	return
+}
+
+// scaleQuantity multiplies the quantity by factor, rounding up or down to the
+// unit the resource is measured in.
+func scaleQuantity(quantity resource.Quantity, name corev1.ResourceName, factor float64, up bool) resource.Quantity {
+	round := math.Floor
+	if up {
+		round = math.Ceil
+	}
+
+	if name == corev1.ResourceCPU {
+		return *resource.NewMilliQuantity(int64(round(float64(quantity.MilliValue())*factor)), quantity.Format)
+	}
+
+	return *resource.NewQuantity(int64(round(float64(quantity.Value())*factor)), quantity.Format)
+}
+
+func zeroQuantity(name corev1.ResourceName) resource.Quantity {
+	if name == corev1.ResourceMemory {
+		return *resource.NewQuantity(0, resource.BinarySI)
+	}
+
+	return *resource.NewQuantity(0, resource.DecimalSI)
+}
+
+func boundQuantity(bounds *CPUMemory, name corev1.ResourceName) *resource.Quantity {
+	if bounds == nil {
+		return nil
+	}
+
+	if name == corev1.ResourceCPU {
+		return bounds.CPU
+	}
+
+	return bounds.Memory
+}
+
+// resourceList returns the requests or the limits, which may be nil.
+func resourceList(resources *corev1.ResourceRequirements, field string) corev1.ResourceList {
+	if field == FieldLimit {
+		return resources.Limits
+	}
+
+	return resources.Requests
+}
@@ -0,0 +1,126 @@
+package clusterresourceoverride
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestPodQuantity(t *testing.T) {
+	tests := []struct {
+		name           string
+		initContainers []corev1.Container
+		containers     []corev1.Container
+		want           string
+	}{
+		{
+			name:       "WithContainersOnly",
+			containers: []corev1.Container{newTestContainer("a", "1", "1", "1Gi", "1Gi"), newTestContainer("b", "1", "1", "1Gi", "1Gi")},
+			want:       "2Gi",
+		},
+		{
+			name:           "WithLargeInitContainer",
+			initContainers: []corev1.Container{newTestContainer("init", "1", "1", "4Gi", "4Gi")},
+			containers:     []corev1.Container{newTestContainer("a", "1", "1", "1Gi", "1Gi")},
+			want:           "4Gi",
+		},
+		{
+			name: "WithSidecars",
+			initContainers: []corev1.Container{
+				newTestSidecar(newTestContainer("sidecar", "1", "1", "1Gi", "1Gi")),
+				newTestContainer("init", "1", "1", "2Gi", "2Gi"),
+			},
+			containers: []corev1.Container{newTestContainer("a", "1", "1", "1Gi", "1Gi")},
+			// the init container runs alongside the sidecar started before it.
+			want: "3Gi",
+		},
+		{
+			name: "WithSidecarsInSteadyState",
+			initContainers: []corev1.Container{
+				newTestContainer("init", "1", "1", "2Gi", "2Gi"),
+				newTestSidecar(newTestContainer("sidecar", "1", "1", "1Gi", "1Gi")),
+			},
+			containers: []corev1.Container{newTestContainer("a", "1", "1", "2Gi", "2Gi")},
+			want:       "3Gi",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{InitContainers: tt.initContainers, Containers: tt.containers}}
+
+			quantityGot := podQuantity(pod, FieldRequest, corev1.ResourceMemory)
+			assert.Equal(t, tt.want, quantityGot.String())
+		})
+	}
+}
+
+func TestOverridePodBounds(t *testing.T) {
+	podFloor := resource.MustParse("1536Mi")
+	podCeiling := resource.MustParse("3")
+
+	config := &Config{
+		LimitCPUToMemoryRatio:     4,
+		MemoryRequestToLimitRatio: 0.5,
+	}
+	mutator, err := NewMutator(config, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+	require.NoError(t, err)
+	mutator.SetPodBounds(&CPUMemory{Memory: &podFloor}, &CPUMemory{CPU: &podCeiling})
+
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{newTestSidecar(newTestContainer("sidecar", "1", "1", "1Gi", "1Gi"))},
+			Containers:     []corev1.Container{newTestContainer("app", "1", "1", "1Gi", "1Gi")},
+		},
+	}
+
+	podGot, err := mutator.Mutate(pod)
+	require.NoError(t, err)
+
+	// the memory requests were halved to 1Gi for the pod, the sidecar counts
+	// towards the floor of 1536Mi.
+	memoryGot := podQuantity(podGot, FieldRequest, corev1.ResourceMemory)
+	assert.Equal(t, "1536Mi", memoryGot.String())
+	assert.Equal(t, "768Mi", podGot.Spec.InitContainers[0].Resources.Requests.Memory().String())
+
+	// the CPU limits were raised to 4 cores each, more than the ceiling of 3.
+	cpuGot := podQuantity(podGot, FieldLimit, corev1.ResourceCPU)
+	assert.Equal(t, "3", cpuGot.String())
+	assert.Equal(t, "1500m", podGot.Spec.Containers[0].Resources.Limits.Cpu().String())
+
+	clamps := mutator.Summary().Clamps()
+	require.Len(t, clamps, 4)
+	for _, clamp := range clamps {
+		assert.Contains(t, []string{BoundPodFloor, BoundPodCeiling}, clamp.Bound)
+	}
+
+	// the patch carries the scaled resources.
+	paths := []string{}
+	for _, operation := range mutator.Operations() {
+		paths = append(paths, operation.Path)
+	}
+	assert.ElementsMatch(t, []string{"/spec/initContainers/0/resources", "/spec/containers/0/resources"}, paths)
+}
+
+func TestOverridePodBoundsKeepsOriginalViolation(t *testing.T) {
+	podFloor := resource.MustParse("8Gi")
+
+	mutator, err := NewMutator(&Config{MemoryRequestToLimitRatio: 0.5}, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+	require.NoError(t, err)
+	mutator.SetPodBounds(&CPUMemory{Memory: &podFloor}, nil)
+
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{newTestContainer("app", "1", "1", "2Gi", "2Gi")},
+		},
+	}
+
+	// the pod was below the floor before the overrides, it is only moved
+	// back to what it requested.
+	podGot, err := mutator.Mutate(pod)
+	require.NoError(t, err)
+	assert.Equal(t, "2Gi", podGot.Spec.Containers[0].Resources.Requests.Memory().String())
+}
@@ -0,0 +1,66 @@
+package clusterresourceoverride
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	schedulingv1listers "k8s.io/client-go/listers/scheduling/v1"
+	"k8s.io/klog"
+)
+
+// priorityGetter returns the priority value of a pod. A nil getter only reads
+// the priority already set on the pod.
+type priorityGetter struct {
+	priorityClasses schedulingv1listers.PriorityClassLister
+}
+
+func newPriorityGetter(priorityClasses schedulingv1listers.PriorityClassLister) *priorityGetter {
+	return &priorityGetter{
+		priorityClasses: priorityClasses,
+	}
+}
+
+// Get returns the priority of the pod. The Priority admission plugin usually
+// sets it before webhooks are called, it is read from the PriorityClass of the
+// pod, or from the global default PriorityClass, otherwise. Pods whose
+// PriorityClass can not be read have a priority of zero, as pods of a cluster
+// without a default PriorityClass do.
+func (g *priorityGetter) Get(pod *corev1.Pod) int32 {
+	if pod.Spec.Priority != nil {
+		return *pod.Spec.Priority
+	}
+	if g == nil {
+		return 0
+	}
+
+	if pod.Spec.PriorityClassName != "" {
+		priorityClass, err := g.priorityClasses.Get(pod.Spec.PriorityClassName)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				klog.Warningf("namespace=%s failed to get PriorityClass %s, matching rules on a priority of 0: %v", pod.Namespace, pod.Spec.PriorityClassName, err)
+			}
+			return 0
+		}
+
+		return priorityClass.Value
+	}
+
+	priorityClasses, err := g.priorityClasses.List(labels.Everything())
+	if err != nil {
+		klog.Warningf("namespace=%s failed to list PriorityClasses, matching rules on a priority of 0: %v", pod.Namespace, err)
+		return 0
+	}
+
+	// the API server picks the lowest of several global defaults.
+	var priority *int32
+	for _, priorityClass := range priorityClasses {
+		if priorityClass.GlobalDefault && (priority == nil || priorityClass.Value < *priority) {
+			priority = &priorityClass.Value
+		}
+	}
+	if priority == nil {
+		return 0
+	}
+
+	return *priority
+}
@@ -0,0 +1,75 @@
+package clusterresourceoverride
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	schedulingv1listers "k8s.io/client-go/listers/scheduling/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestPriorityGetter(t *testing.T, priorityClasses ...*schedulingv1.PriorityClass) *priorityGetter {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, priorityClass := range priorityClasses {
+		require.NoError(t, indexer.Add(priorityClass))
+	}
+
+	return newPriorityGetter(schedulingv1listers.NewPriorityClassLister(indexer))
+}
+
+func newTestPriorityClass(name string, value int32, globalDefault bool) *schedulingv1.PriorityClass {
+	return &schedulingv1.PriorityClass{ObjectMeta: metav1.ObjectMeta{Name: name}, Value: value, GlobalDefault: globalDefault}
+}
+
+func TestPriorityGetter(t *testing.T) {
+	priority := int32(7)
+	high := newTestPriorityClass("high", 1000, false)
+
+	tests := []struct {
+		name   string
+		getter *priorityGetter
+		spec   corev1.PodSpec
+		want   int32
+	}{
+		{
+			name:   "WithPrioritySet",
+			getter: newTestPriorityGetter(t, high),
+			spec:   corev1.PodSpec{PriorityClassName: "high", Priority: &priority},
+			want:   7,
+		},
+		{
+			name:   "WithPriorityClass",
+			getter: newTestPriorityGetter(t, high),
+			spec:   corev1.PodSpec{PriorityClassName: "high"},
+			want:   1000,
+		},
+		{
+			name:   "WithMissingPriorityClass",
+			getter: newTestPriorityGetter(t, high),
+			spec:   corev1.PodSpec{PriorityClassName: "low"},
+		},
+		{
+			name:   "WithGlobalDefaults",
+			getter: newTestPriorityGetter(t, high, newTestPriorityClass("default", 100, true), newTestPriorityClass("other-default", 50, true)),
+			want:   50,
+		},
+		{
+			name:   "WithoutGlobalDefault",
+			getter: newTestPriorityGetter(t, high),
+		},
+		{
+			name: "WithNilGetter",
+			spec: corev1.PodSpec{PriorityClassName: "high"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.getter.Get(&corev1.Pod{Spec: tt.spec}))
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package clusterresourceoverride
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog"
+)
+
+const (
+	// QoSActionSkipped means the resources of the pod were left untouched
+	// because it is Guaranteed.
+	QoSActionSkipped = "skipped"
+
+	// QoSActionPreserved means the requests of a Guaranteed pod were set to
+	// its overridden limits to keep it Guaranteed.
+	QoSActionPreserved = "preserved"
+
+	// QoSActionReverted means the overrides were undone because they changed
+	// the QoS class of the pod.
+	QoSActionReverted = "reverted"
+)
+
+// preserves returns true if pods of the given QoS class keep it.
+func (p *QoSPolicy) preserves(class corev1.PodQOSClass) bool {
+	for _, preserved := range p.Preserve {
+		if preserved == class {
+			return true
+		}
+	}
+
+	return false
+}
+
+// podQOSClass returns the QoS class of the pod, the way the kubelet computes
+// it from its pod-level resources if set, or the resources of its containers.
+func podQOSClass(pod *corev1.Pod) corev1.PodQOSClass {
+	if pod.Spec.Resources != nil && (len(pod.Spec.Resources.Requests) > 0 || len(pod.Spec.Resources.Limits) > 0) {
+		return qosClass([]corev1.ResourceRequirements{*pod.Spec.Resources})
+	}
+
+	resources := make([]corev1.ResourceRequirements, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	for i := range pod.Spec.InitContainers {
+		resources = append(resources, pod.Spec.InitContainers[i].Resources)
+	}
+	for i := range pod.Spec.Containers {
+		resources = append(resources, pod.Spec.Containers[i].Resources)
+	}
+
+	return qosClass(resources)
+}
+
+// qosClass returns the QoS class of a pod with the given resources: Guaranteed
+// if each of them limits CPU and memory and the requests add up to the limits,
+// BestEffort if none of them requests or limits anything, Burstable otherwise.
+func qosClass(resources []corev1.ResourceRequirements) corev1.PodQOSClass {
+	requests, limits := corev1.ResourceList{}, corev1.ResourceList{}
+	guaranteed := true
+	for i := range resources {
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			if quantity, found := resources[i].Requests[name]; found && !quantity.IsZero() {
+				addQuantity(requests, name, quantity)
+			}
+
+			quantity, found := resources[i].Limits[name]
+			if !found || quantity.IsZero() {
+				guaranteed = false
+				continue
+			}
+			addQuantity(limits, name, quantity)
+		}
+	}
+
+	if len(requests) == 0 && len(limits) == 0 {
+		return corev1.PodQOSBestEffort
+	}
+
+	if !guaranteed || len(requests) != len(limits) {
+		return corev1.PodQOSBurstable
+	}
+
+	for name, request := range requests {
+		if limit := limits[name]; request.Cmp(limit) != 0 {
+			return corev1.PodQOSBurstable
+		}
+	}
+
+	return corev1.PodQOSGuaranteed
+}
+
+func addQuantity(list corev1.ResourceList, name corev1.ResourceName, quantity resource.Quantity) {
+	sum, found := list[name]
+	if !found {
+		list[name] = quantity.DeepCopy()
+		return
+	}
+
+	sum.Add(quantity)
+	list[name] = sum
+}
+
+// PreserveQoS keeps the overridden pod in the QoS class the original pod had,
+// if the configuration preserves it. The requests of a Guaranteed pod are set
+// to its overridden limits; if that does not keep the class, the resources of
+// the pod are reverted to the original ones.
+func (m *podMutator) PreserveQoS(original, pod *corev1.Pod) {
+	before := m.summary.QoSBefore
+	if !m.config.QoS.preserves(before) || podQOSClass(pod) == before {
+		return
+	}
+
+	if before == corev1.PodQOSGuaranteed {
+		m.setRequestsToLimits(pod)
+		if podQOSClass(pod) == before {
+			klog.V(5).Infof("pod requests set to its limits to keep it %s", before)
+			m.summary.QoSAction = QoSActionPreserved
+			return
+		}
+	}
+
+	klog.V(5).Infof("overrides would move the pod out of %s; reverting its resources", before)
+	for i := range pod.Spec.InitContainers {
+		pod.Spec.InitContainers[i].Resources = *original.Spec.InitContainers[i].Resources.DeepCopy()
+	}
+	for i := range pod.Spec.Containers {
+		pod.Spec.Containers[i].Resources = *original.Spec.Containers[i].Resources.DeepCopy()
+	}
+	pod.Spec.Resources = original.Spec.Resources.DeepCopy()
+
+	m.summary.Containers = nil
+	m.summary.Pod = nil
+	m.summary.QoSAction = QoSActionReverted
+}
+
+// setRequestsToLimits sets the CPU and memory requests of the overridden
+// containers, and of the pod if it has pod-level resources, to their limits.
+func (m *podMutator) setRequestsToLimits(pod *corev1.Pod) {
+	for _, container := range podContainers(pod) {
+		mutation := m.summary.container(container.Name)
+		if mutation == nil {
+			continue
+		}
+
+		if requestsToLimits(&container.Resources) {
+			mutation.After = *container.Resources.DeepCopy()
+		}
+	}
+
+	if pod.Spec.Resources != nil && requestsToLimits(pod.Spec.Resources) && m.summary.Pod != nil {
+		m.summary.Pod.After = *pod.Spec.Resources.DeepCopy()
+	}
+}
+
+// requestsToLimits sets the CPU and memory requests to the limits, if any. It
+// returns true if a request changed.
+func requestsToLimits(resources *corev1.ResourceRequirements) (changed bool) {
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		limit, found := resources.Limits[name]
+		if !found {
+			continue
+		}
+
+		if request, found := resources.Requests[name]; found && request.Cmp(limit) == 0 {
+			continue
+		}
+
+		if resources.Requests == nil {
+			resources.Requests = corev1.ResourceList{}
+		}
+		resources.Requests[name] = limit.DeepCopy()
+		changed = true
+	}
+
+	return
+}
+
+// RoundExclusiveCPU rounds the overridden CPU request and limit of containers
+// that requested exclusive CPUs up to whole cores, so that the static CPU
+// manager policy still pins them. A container requests exclusive CPUs if it is
+// in a Guaranteed pod and its original CPU request is a whole number of cores.
+func (m *podMutator) RoundExclusiveCPU(original, pod *corev1.Pod) {
+	if m.summary.QoSBefore != corev1.PodQOSGuaranteed {
+		return
+	}
+
+	originals := podContainers(original)
+	for i, container := range podContainers(pod) {
+		mutation := m.summary.container(container.Name)
+		request, found := originals[i].Resources.Requests[corev1.ResourceCPU]
+		if mutation == nil || !found || request.IsZero() || request.MilliValue()%1000 != 0 {
+			continue
+		}
+
+		rounded := false
+		for _, list := range []corev1.ResourceList{container.Resources.Requests, container.Resources.Limits} {
+			quantity, found := list[corev1.ResourceCPU]
+			if !found || quantity.MilliValue()%1000 == 0 {
+				continue
+			}
+
+			cores := *resource.NewQuantity((quantity.MilliValue()+999)/1000, resource.DecimalSI)
+			klog.V(5).Infof("container %s requests exclusive CPUs; rounding CPU %q up to %q", container.Name, quantity.String(), cores.String())
+			list[corev1.ResourceCPU] = cores
+			rounded = true
+		}
+
+		if rounded {
+			mutation.After = *container.Resources.DeepCopy()
+		}
+	}
+}
+
+// podContainers returns the init and regular containers of the pod.
+func podContainers(pod *corev1.Pod) []*corev1.Container {
+	containers := make([]*corev1.Container, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	for i := range pod.Spec.InitContainers {
+		containers = append(containers, &pod.Spec.InitContainers[i])
+	}
+	for i := range pod.Spec.Containers {
+		containers = append(containers, &pod.Spec.Containers[i])
+	}
+
+	return containers
+}
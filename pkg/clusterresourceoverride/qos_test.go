@@ -0,0 +1,170 @@
+package clusterresourceoverride
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestPodQOSClass(t *testing.T) {
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want corev1.PodQOSClass
+	}{
+		{
+			name: "WithRequestsEqualToLimits",
+			pod:  newTestPod(newTestContainer("app", "1", "1", "1Gi", "1Gi")),
+			want: corev1.PodQOSGuaranteed,
+		},
+		{
+			name: "WithLimitsOnly",
+			pod:  newTestPod(newTestContainer("app", "", "1", "", "1Gi")),
+			want: corev1.PodQOSBurstable,
+		},
+		{
+			name: "WithRequestsBelowLimits",
+			pod:  newTestPod(newTestContainer("app", "500m", "1", "1Gi", "1Gi")),
+			want: corev1.PodQOSBurstable,
+		},
+		{
+			name: "WithoutCPULimit",
+			pod:  newTestPod(newTestContainer("app", "1", "", "1Gi", "1Gi")),
+			want: corev1.PodQOSBurstable,
+		},
+		{
+			name: "WithoutResources",
+			pod:  newTestPod(newTestContainer("app", "", "", "", "")),
+			want: corev1.PodQOSBestEffort,
+		},
+		{
+			name: "WithPodLevelResources",
+			pod: func() *corev1.Pod {
+				pod := newTestPod(newTestContainer("app", "", "", "", ""))
+				resources := newTestResources("1", "1", "1Gi", "1Gi")
+				pod.Spec.Resources = &resources
+				return pod
+			}(),
+			want: corev1.PodQOSGuaranteed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, podQOSClass(tt.pod))
+		})
+	}
+}
+
+func TestMutateQoS(t *testing.T) {
+	tests := []struct {
+		name              string
+		config            *Config
+		pod               *corev1.Pod
+		wantCPURequest    string
+		wantCPULimit      string
+		wantMemoryRequest string
+		wantQoSAfter      corev1.PodQOSClass
+		wantAction        string
+	}{
+		{
+			name:              "WithoutPolicy",
+			config:            &Config{MemoryRequestToLimitRatio: 0.5},
+			pod:               newTestPod(newTestContainer("app", "1", "1", "1Gi", "1Gi")),
+			wantCPURequest:    "1",
+			wantCPULimit:      "1",
+			wantMemoryRequest: "512Mi",
+			wantQoSAfter:      corev1.PodQOSBurstable,
+		},
+		{
+			name:              "WithGuaranteedSkipped",
+			config:            &Config{MemoryRequestToLimitRatio: 0.5, QoS: QoSPolicy{SkipGuaranteed: true}},
+			pod:               newTestPod(newTestContainer("app", "1", "1", "1Gi", "1Gi")),
+			wantCPURequest:    "1",
+			wantCPULimit:      "1",
+			wantMemoryRequest: "1Gi",
+			wantQoSAfter:      corev1.PodQOSGuaranteed,
+			wantAction:        QoSActionSkipped,
+		},
+		{
+			name:              "WithBurstableNotSkipped",
+			config:            &Config{MemoryRequestToLimitRatio: 0.5, QoS: QoSPolicy{SkipGuaranteed: true}},
+			pod:               newTestPod(newTestContainer("app", "500m", "1", "1Gi", "1Gi")),
+			wantCPURequest:    "500m",
+			wantCPULimit:      "1",
+			wantMemoryRequest: "512Mi",
+			wantQoSAfter:      corev1.PodQOSBurstable,
+		},
+		{
+			name:              "WithGuaranteedPreserved",
+			config:            &Config{LimitCPUToMemoryRatio: 1.5, CpuRequestToLimitRatio: 0.5, QoS: QoSPolicy{Preserve: []corev1.PodQOSClass{corev1.PodQOSGuaranteed}}},
+			pod:               newTestPod(newTestContainer("app", "1", "1", "1Gi", "1Gi")),
+			wantCPURequest:    "1500m",
+			wantCPULimit:      "1500m",
+			wantMemoryRequest: "1Gi",
+			wantQoSAfter:      corev1.PodQOSGuaranteed,
+			wantAction:        QoSActionPreserved,
+		},
+		{
+			name: "WithExclusiveCPURounded",
+			config: &Config{LimitCPUToMemoryRatio: 1.5, CpuRequestToLimitRatio: 0.5, QoS: QoSPolicy{
+				Preserve:     []corev1.PodQOSClass{corev1.PodQOSGuaranteed},
+				WholeCoreCPU: true,
+			}},
+			pod:               newTestPod(newTestContainer("app", "1", "1", "1Gi", "1Gi")),
+			wantCPURequest:    "2",
+			wantCPULimit:      "2",
+			wantMemoryRequest: "1Gi",
+			wantQoSAfter:      corev1.PodQOSGuaranteed,
+			wantAction:        QoSActionPreserved,
+		},
+		{
+			name: "WithSharedCPUNotRounded",
+			config: &Config{LimitCPUToMemoryRatio: 1.5, CpuRequestToLimitRatio: 0.5, QoS: QoSPolicy{
+				Preserve:     []corev1.PodQOSClass{corev1.PodQOSGuaranteed},
+				WholeCoreCPU: true,
+			}},
+			pod:               newTestPod(newTestContainer("app", "500m", "500m", "1Gi", "1Gi")),
+			wantCPURequest:    "1500m",
+			wantCPULimit:      "1500m",
+			wantMemoryRequest: "1Gi",
+			wantQoSAfter:      corev1.PodQOSGuaranteed,
+			wantAction:        QoSActionPreserved,
+		},
+		{
+			name: "WithBurstableReverted",
+			config: &Config{MemoryRequestToLimitRatio: 1, LimitCPUToMemoryRatio: 1, CpuRequestToLimitRatio: 1, QoS: QoSPolicy{
+				Preserve: []corev1.PodQOSClass{corev1.PodQOSBurstable},
+			}},
+			pod:               newTestPod(newTestContainer("app", "", "", "512Mi", "1Gi")),
+			wantMemoryRequest: "512Mi",
+			wantQoSAfter:      corev1.PodQOSBurstable,
+			wantAction:        QoSActionReverted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mutator, err := NewMutator(tt.config, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+			require.NoError(t, err)
+
+			podGot, err := mutator.Mutate(tt.pod)
+			require.NoError(t, err)
+
+			resources := podGot.Spec.Containers[0].Resources
+			quantityOf := func(list corev1.ResourceList, name corev1.ResourceName) string {
+				if quantity, found := list[name]; found {
+					return quantity.String()
+				}
+				return ""
+			}
+			assert.Equal(t, tt.wantCPURequest, quantityOf(resources.Requests, corev1.ResourceCPU))
+			assert.Equal(t, tt.wantCPULimit, quantityOf(resources.Limits, corev1.ResourceCPU))
+			assert.Equal(t, tt.wantMemoryRequest, quantityOf(resources.Requests, corev1.ResourceMemory))
+			assert.Equal(t, tt.wantQoSAfter, mutator.Summary().QoSAfter)
+			assert.Equal(t, tt.wantAction, mutator.Summary().QoSAction)
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package clusterresourceoverride
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+)
+
+// Quota is a quota that applies to the pods of a namespace, with the amounts
+// it allows and the amounts already used.
+type Quota struct {
+	// Kind and Name identify the quota in rejections, for example
+	// ResourceQuota/compute.
+	Kind string
+	Name string
+	Hard corev1.ResourceList
+	Used corev1.ResourceList
+}
+
+// QuotaSource lists the quotas that apply to the pods of a namespace. Besides
+// the ResourceQuotas of the namespace, it stands in for quotas of other kinds,
+// such as OpenShift ClusterResourceQuotas, whose total hard and used amounts
+// map to a Quota.
+type QuotaSource interface {
+	ForNamespace(namespace string) ([]Quota, error)
+}
+
+// resourceQuotaSource lists the ResourceQuotas of a namespace. Quotas with
+// scopes only apply to some pods and are left out.
+type resourceQuotaSource struct {
+	lister corev1listers.ResourceQuotaLister
+}
+
+func newResourceQuotaSource(lister corev1listers.ResourceQuotaLister) *resourceQuotaSource {
+	return &resourceQuotaSource{
+		lister: lister,
+	}
+}
+
+func (s *resourceQuotaSource) ForNamespace(namespace string) (quotas []Quota, err error) {
+	resourceQuotas, listErr := s.lister.ResourceQuotas(namespace).List(labels.Everything())
+	if listErr != nil {
+		err = fmt.Errorf("failed to list resourcequotas - %v", listErr)
+		return
+	}
+
+	for _, resourceQuota := range resourceQuotas {
+		if len(resourceQuota.Spec.Scopes) > 0 || resourceQuota.Spec.ScopeSelector != nil {
+			continue
+		}
+
+		// the quota controller sets the enforced hard amounts in the status.
+		hard := resourceQuota.Status.Hard
+		if hard == nil {
+			hard = resourceQuota.Spec.Hard
+		}
+
+		quotas = append(quotas, Quota{
+			Kind: "ResourceQuota",
+			Name: resourceQuota.Name,
+			Hard: hard,
+			Used: resourceQuota.Status.Used,
+		})
+	}
+
+	return
+}
+
+// quotaKeys maps the quota resources to the pod values they bound.
+var quotaKeys = map[corev1.ResourceName]quotaKey{
+	corev1.ResourceCPU:            {field: FieldRequest, name: corev1.ResourceCPU},
+	corev1.ResourceMemory:         {field: FieldRequest, name: corev1.ResourceMemory},
+	corev1.ResourceRequestsCPU:    {field: FieldRequest, name: corev1.ResourceCPU},
+	corev1.ResourceRequestsMemory: {field: FieldRequest, name: corev1.ResourceMemory},
+	corev1.ResourceLimitsCPU:      {field: FieldLimit, name: corev1.ResourceCPU},
+	corev1.ResourceLimitsMemory:   {field: FieldLimit, name: corev1.ResourceMemory},
+}
+
+type quotaKey struct {
+	field string
+	name  corev1.ResourceName
+}
+
+// quotaLeft is what is left of a quota for a value of a pod.
+type quotaLeft struct {
+	quota    string
+	resource corev1.ResourceName
+	hard     resource.Quantity
+	left     resource.Quantity
+}
+
+// quotaHeadroom is what is left of the quotas of a namespace for each value
+// of a pod, the tightest quota deciding.
+type quotaHeadroom map[quotaKey]*quotaLeft
+
+func newQuotaHeadroom(quotas []Quota) quotaHeadroom {
+	headroom := quotaHeadroom{}
+	for _, quota := range quotas {
+		for resourceName, hard := range quota.Hard {
+			key, found := quotaKeys[resourceName]
+			if !found {
+				continue
+			}
+
+			left := hard.DeepCopy()
+			if used, found := quota.Used[resourceName]; found {
+				left.Sub(used)
+			}
+
+			if current, found := headroom[key]; found && current.left.Cmp(left) <= 0 {
+				continue
+			}
+
+			headroom[key] = &quotaLeft{
+				quota:    fmt.Sprintf("%s/%s", quota.Kind, quota.Name),
+				resource: resourceName,
+				hard:     hard.DeepCopy(),
+				left:     left,
+			}
+		}
+	}
+
+	return headroom
+}
+
+// SetQuotaHeadroom sets what is left of the quotas of the namespace, which
+// bounds the values the overrides raise.
+func (m *podMutator) SetQuotaHeadroom(headroom quotaHeadroom) {
+	m.quota = headroom
+}
+
+// quotaCeiling returns what is left of the quotas for the given value when
+// pods are scaled back within the quotas, nil otherwise.
+func (m *podMutator) quotaCeiling(field string, name corev1.ResourceName) *resource.Quantity {
+	if m.config.QuotaAction != QuotaActionScale {
+		return nil
+	}
+
+	if left, found := m.quota[quotaKey{field: field, name: name}]; found {
+		return &left.left
+	}
+
+	return nil
+}
+
+// CheckQuota returns an error naming the quota and the overrides if the
+// overrides pushed the pod over a quota of the namespace. A pod that was over
+// a quota before the overrides is left for the quota admission to reject.
+func (m *podMutator) CheckQuota(original, pod *corev1.Pod) error {
+	for _, field := range []string{FieldRequest, FieldLimit} {
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			left, found := m.quota[quotaKey{field: field, name: name}]
+			if !found {
+				continue
+			}
+
+			before, after := m.effectiveQuantity(original, field, name), m.effectiveQuantity(pod, field, name)
+			if after.Cmp(left.left) <= 0 || after.Cmp(before) <= 0 {
+				continue
+			}
+
+			return fmt.Errorf("overrides push the pod over %s: %s of the pod would be %s with %s of %s left, raised from %s by %s",
+				left.quota, left.resource, after.String(), left.left.String(), left.hard.String(), before.String(), m.overrideCauses(field, name))
+		}
+	}
+
+	return nil
+}
+
+// overrideCauses describes the overrides that raised the given value of the
+// containers of the pod.
+func (m *podMutator) overrideCauses(field string, name corev1.ResourceName) string {
+	mutations := append([]ContainerMutation{}, m.summary.Containers...)
+	if m.summary.Pod != nil {
+		mutations = append(mutations, *m.summary.Pod)
+	}
+
+	causes := []string{}
+	for i := range mutations {
+		mutation := &mutations[i]
+		before, hadValue := resourceList(&mutation.Before, field)[name]
+		after, found := resourceList(&mutation.After, field)[name]
+		if !found || (hadValue && after.Cmp(before) <= 0) {
+			continue
+		}
+
+		subject := fmt.Sprintf("container %s", mutation.Name)
+		if mutation.Name == "" {
+			subject = "pod-level resources"
+		}
+
+		how := "overridden"
+		switch {
+		case !hadValue:
+			how = "derived from the request"
+		case mutation.clampedTo(name, field, BoundFloor, BoundPodFloor):
+			how = "raised to the namespace minimum"
+		}
+
+		causes = append(causes, fmt.Sprintf("%s %s %s %s", subject, name, field, how))
+	}
+
+	if len(causes) == 0 {
+		return "the overrides"
+	}
+
+	return strings.Join(causes, ", ")
+}
+
+// clampedTo returns true if the given value was clamped to one of the bounds.
+func (c *ContainerMutation) clampedTo(name corev1.ResourceName, field string, bounds ...string) bool {
+	for _, clamp := range c.Clamps {
+		for _, bound := range bounds {
+			if clamp.Resource == name && clamp.Field == field && clamp.Bound == bound {
+				return true
+			}
+		}
+	}
+
+	return false
+}
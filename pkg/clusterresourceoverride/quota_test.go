@@ -0,0 +1,145 @@
+package clusterresourceoverride
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+type fakeQuotaSource []Quota
+
+func (s fakeQuotaSource) ForNamespace(namespace string) ([]Quota, error) {
+	return s, nil
+}
+
+func newTestQuota(name, hardLimitsMemory, usedLimitsMemory string) Quota {
+	return Quota{
+		Kind: "ResourceQuota",
+		Name: name,
+		Hard: corev1.ResourceList{corev1.ResourceLimitsMemory: resource.MustParse(hardLimitsMemory)},
+		Used: corev1.ResourceList{corev1.ResourceLimitsMemory: resource.MustParse(usedLimitsMemory)},
+	}
+}
+
+func TestResourceQuotaSource(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	require.NoError(t, indexer.Add(&corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "compute", Namespace: "foo"},
+		Spec:       corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{corev1.ResourceLimitsMemory: resource.MustParse("8Gi")}},
+		Status: corev1.ResourceQuotaStatus{
+			Hard: corev1.ResourceList{corev1.ResourceLimitsMemory: resource.MustParse("4Gi")},
+			Used: corev1.ResourceList{corev1.ResourceLimitsMemory: resource.MustParse("1Gi")},
+		},
+	}))
+	require.NoError(t, indexer.Add(&corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "terminating", Namespace: "foo"},
+		Spec: corev1.ResourceQuotaSpec{
+			Hard:   corev1.ResourceList{corev1.ResourceLimitsMemory: resource.MustParse("1Gi")},
+			Scopes: []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeTerminating},
+		},
+	}))
+	source := newResourceQuotaSource(corev1listers.NewResourceQuotaLister(indexer))
+
+	quotasGot, err := source.ForNamespace("foo")
+	require.NoError(t, err)
+	require.Len(t, quotasGot, 1)
+	assert.Equal(t, "compute", quotasGot[0].Name)
+	assert.Equal(t, "4Gi", quotasGot[0].Hard.Name(corev1.ResourceLimitsMemory, resource.BinarySI).String())
+}
+
+func TestNewQuotaHeadroom(t *testing.T) {
+	headroom := newQuotaHeadroom([]Quota{
+		newTestQuota("large", "16Gi", "4Gi"),
+		newTestQuota("small", "4Gi", "3Gi"),
+	})
+
+	left := headroom[quotaKey{field: FieldLimit, name: corev1.ResourceMemory}]
+	require.NotNil(t, left)
+	assert.Equal(t, "ResourceQuota/small", left.quota)
+	assert.Equal(t, "1Gi", left.left.String())
+	assert.Nil(t, headroom[quotaKey{field: FieldRequest, name: corev1.ResourceMemory}])
+}
+
+func TestMutateWithQuota(t *testing.T) {
+	// the derived limit of 2Gi does not fit in the 1Gi left.
+	pod := newTestPod(newTestContainer("app", "", "", "512Mi", ""))
+	headroom := newQuotaHeadroom([]Quota{newTestQuota("compute", "3Gi", "2Gi")})
+
+	t.Run("WithReject", func(t *testing.T) {
+		mutator, err := NewMutator(&Config{MemoryLimitToRequestRatio: 4, QuotaAction: QuotaActionReject}, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+		require.NoError(t, err)
+		mutator.SetQuotaHeadroom(headroom)
+
+		podGot, err := mutator.Mutate(pod)
+		require.NoError(t, err)
+		assert.Equal(t, "2Gi", podGot.Spec.Containers[0].Resources.Limits.Memory().String())
+
+		errGot := mutator.CheckQuota(pod, podGot)
+		require.Error(t, errGot)
+		assert.Contains(t, errGot.Error(), "ResourceQuota/compute")
+		assert.Contains(t, errGot.Error(), "limits.memory")
+		assert.Contains(t, errGot.Error(), "container app memory limit derived from the request")
+	})
+
+	t.Run("WithScale", func(t *testing.T) {
+		mutator, err := NewMutator(&Config{MemoryLimitToRequestRatio: 4, QuotaAction: QuotaActionScale}, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+		require.NoError(t, err)
+		mutator.SetQuotaHeadroom(headroom)
+
+		podGot, err := mutator.Mutate(pod)
+		require.NoError(t, err)
+		assert.Equal(t, "1Gi", podGot.Spec.Containers[0].Resources.Limits.Memory().String())
+		assert.NoError(t, mutator.CheckQuota(pod, podGot))
+
+		clamps := mutator.Summary().Clamps()
+		require.Len(t, clamps, 1)
+		assert.Equal(t, BoundQuota, clamps[0].Bound)
+	})
+
+	t.Run("WithPodOverQuotaBefore", func(t *testing.T) {
+		mutator, err := NewMutator(&Config{MemoryRequestToLimitRatio: 0.5, QuotaAction: QuotaActionReject}, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+		require.NoError(t, err)
+		mutator.SetQuotaHeadroom(headroom)
+
+		// the quota admission rejects the pod, the overrides did not cause it.
+		overQuota := newTestPod(newTestContainer("app", "", "", "", "2Gi"))
+		podGot, err := mutator.Mutate(overQuota)
+		require.NoError(t, err)
+		assert.NoError(t, mutator.CheckQuota(overQuota, podGot))
+	})
+}
+
+func TestAdmitWithQuota(t *testing.T) {
+	querier, _ := newTestLimitQuerier(t, nil)
+	admission := &clusterResourceOverrideAdmission{
+		config:       &Config{MemoryLimitToRequestRatio: 4, QuotaAction: QuotaActionReject},
+		limitQuerier: querier,
+		quotas:       []QuotaSource{fakeQuotaSource{newTestQuota("compute", "3Gi", "2Gi")}},
+	}
+
+	pod := newTestPod(newTestContainer("app", "", "", "512Mi", ""))
+	raw, err := json.Marshal(pod)
+	require.NoError(t, err)
+
+	decision := &Decision{}
+	response := admission.Admit(WithDecision(context.TODO(), decision), &admissionv1.AdmissionRequest{
+		Namespace: "foo",
+		Operation: admissionv1.Create,
+		Resource:  metav1.GroupVersionResource{Resource: string(corev1.ResourcePods)},
+		Object:    runtime.RawExtension{Raw: raw},
+	})
+	assert.False(t, response.Allowed)
+	assert.Contains(t, response.Result.Message, "ResourceQuota/compute")
+	assert.True(t, decision.Rejected)
+	assert.Equal(t, "resource_quota", response.AuditAnnotations[AuditRejectedKey])
+}
@@ -0,0 +1,164 @@
+package clusterresourceoverride
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+const (
+	// ResizeSubResource is the subresource of pods through which the
+	// resources of running containers are changed in place.
+	ResizeSubResource = "resize"
+)
+
+// MutateResize applies the overrides to the containers and sidecars whose
+// resources are changed by resizing old into in. The API server ignores
+// changes to anything but container resources made through the resize
+// subresource, so only resources are patched and the original CPU request
+// annotation can't be updated: the CPU request a resize sets is kept as its
+// original one, see resizeContainer.
+func (m *podMutator) MutateResize(old, in *corev1.Pod) (out *corev1.Pod, err error) {
+	current := in.DeepCopy()
+	m.summary = &MutationSummary{}
+	m.operations = nil
+	m.input = newExpressionInput(in, m.namespace)
+	m.err = nil
+
+	m.resizing = true
+	defer func() {
+		m.resizing = false
+	}()
+
+	// container names are unique across init containers and containers.
+	previous := map[string]*corev1.Container{}
+	for i := range old.Spec.InitContainers {
+		previous[old.Spec.InitContainers[i].Name] = &old.Spec.InitContainers[i]
+	}
+	for i := range old.Spec.Containers {
+		previous[old.Spec.Containers[i].Name] = &old.Spec.Containers[i]
+	}
+
+	resize := func(path string, class ContainerClass, container *corev1.Container) {
+		before, found := previous[container.Name]
+		if !found || equality.Semantic.DeepEqual(before.Resources, container.Resources) {
+			return
+		}
+
+		m.resizeContainer(path, class, container, before, current)
+	}
+
+	for i := range current.Spec.InitContainers {
+		container := &current.Spec.InitContainers[i]
+		resize(fmt.Sprintf("/spec/initContainers/%d", i), initContainerClass(container), container)
+	}
+	for i := range current.Spec.Containers {
+		resize(fmt.Sprintf("/spec/containers/%d", i), ContainerClassRegular, &current.Spec.Containers[i])
+	}
+	if m.err != nil {
+		err = m.err
+		return
+	}
+
+	out = current
+	return
+}
+
+// resizeContainer overrides the resources the container is resized to. A
+// resource whose resize requires restarting the container is left as
+// requested unless the resize already changes it.
+//
+// The original CPU request annotation only holds the CPU request the
+// container was created with, and the webhook can't tell a resize that sets
+// a CPU request from its own reinvocation on a resize it already overrode.
+// The CPU request of the resized container is therefore its original one:
+// the percent of the original request is not applied again, which keeps the
+// CPU request a resize sets and the one an earlier resize set.
+func (m *podMutator) resizeContainer(path string, class ContainerClass, container, before *corev1.Container, pod *corev1.Pod) {
+	requested := container.Resources.DeepCopy()
+
+	// Override annotates the scratch pod, which is not part of the patch,
+	// with the requested CPU request.
+	scratch := pod.DeepCopy()
+	delete(scratch.Annotations, m.originalRequestKey(container.Name))
+
+	operations := len(m.operations)
+	overridden := m.overrideClass(class, container, scratch)
+	m.operations = m.operations[:operations]
+	if !overridden {
+		return
+	}
+
+	restored := map[corev1.ResourceName]bool{}
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		if requiresRestart(container, name) && !resourceChanged(before.Resources, *requested, name) {
+			restoreResource(&container.Resources, requested, name)
+			restored[name] = true
+		}
+	}
+
+	if len(restored) > 0 && m.summary != nil && len(m.summary.Containers) > 0 {
+		mutation := &m.summary.Containers[len(m.summary.Containers)-1]
+		mutation.After = *container.Resources.DeepCopy()
+
+		clamps := mutation.Clamps[:0]
+		for _, clamp := range mutation.Clamps {
+			if !restored[clamp.Resource] {
+				clamps = append(clamps, clamp)
+			}
+		}
+		mutation.Clamps = clamps
+	}
+
+	if !equality.Semantic.DeepEqual(*requested, container.Resources) {
+		m.addOperation(path+"/resources", container.Resources.DeepCopy())
+	}
+}
+
+// requiresRestart returns true if resizing the given resource restarts the container.
+func requiresRestart(container *corev1.Container, name corev1.ResourceName) bool {
+	for _, policy := range container.ResizePolicy {
+		if policy.ResourceName == name {
+			return policy.RestartPolicy == corev1.RestartContainer
+		}
+	}
+
+	return false
+}
+
+// resourceChanged returns true if the request or the limit of the given
+// resource differ between before and after.
+func resourceChanged(before, after corev1.ResourceRequirements, name corev1.ResourceName) bool {
+	return !quantityEqual(before.Requests, after.Requests, name) || !quantityEqual(before.Limits, after.Limits, name)
+}
+
+func quantityEqual(a, b corev1.ResourceList, name corev1.ResourceName) bool {
+	qa, foundA := a[name]
+	qb, foundB := b[name]
+	if foundA != foundB {
+		return false
+	}
+
+	return !foundA || qa.Cmp(qb) == 0
+}
+
+// restoreResource sets the request and limit of the given resource back to
+// their value in from.
+func restoreResource(resources *corev1.ResourceRequirements, from *corev1.ResourceRequirements, name corev1.ResourceName) {
+	restore := func(list *corev1.ResourceList, original corev1.ResourceList) {
+		quantity, found := original[name]
+		if !found {
+			delete(*list, name)
+			return
+		}
+
+		if *list == nil {
+			*list = corev1.ResourceList{}
+		}
+		(*list)[name] = quantity.DeepCopy()
+	}
+
+	restore(&resources.Requests, from.Requests)
+	restore(&resources.Limits, from.Limits)
+}
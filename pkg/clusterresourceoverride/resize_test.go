@@ -0,0 +1,243 @@
+package clusterresourceoverride
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	jsonpatch "gomodules.xyz/jsonpatch/v2"
+	evanjsonpatch "gopkg.in/evanphx/json-patch.v4"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestMutateResize(t *testing.T) {
+	config := &Config{
+		LimitCPUToMemoryRatio:     2,
+		CpuRequestToLimitRatio:    0.25,
+		MemoryRequestToLimitRatio: 0.5,
+	}
+
+	tests := []struct {
+		name          string
+		policy        corev1.ResourceResizeRestartPolicy
+		resizedMemory string
+		resizedCPU    string
+		operations    []string
+		memoryRequest string
+		cpuRequest    string
+		cpuLimit      string
+	}{
+		{
+			name:          "WithMemoryResized",
+			policy:        corev1.NotRequired,
+			resizedMemory: "2Gi",
+			resizedCPU:    "2",
+			operations:    []string{"/spec/containers/0/resources"},
+			memoryRequest: "1Gi",
+			cpuRequest:    "1",
+			cpuLimit:      "4",
+		},
+		{
+			name:          "WithCPURequiringRestartUnchanged",
+			policy:        corev1.RestartContainer,
+			resizedMemory: "2Gi",
+			resizedCPU:    "2",
+			operations:    []string{"/spec/containers/0/resources"},
+			memoryRequest: "1Gi",
+			cpuRequest:    "250m",
+			cpuLimit:      "2",
+		},
+		{
+			name:          "WithCPURequiringRestartResized",
+			policy:        corev1.RestartContainer,
+			resizedMemory: "1Gi",
+			resizedCPU:    "4",
+			operations:    []string{"/spec/containers/0/resources"},
+			memoryRequest: "512Mi",
+			cpuRequest:    "500m",
+			cpuLimit:      "2",
+		},
+		{
+			name:          "WithNothingResized",
+			policy:        corev1.NotRequired,
+			resizedMemory: "1Gi",
+			resizedCPU:    "2",
+			memoryRequest: "512Mi",
+			cpuRequest:    "250m",
+			cpuLimit:      "2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mutator, err := NewMutator(config, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+			require.NoError(t, err)
+
+			app := newTestContainer("app", "250m", "2", "512Mi", "1Gi")
+			app.ResizePolicy = []corev1.ContainerResizePolicy{{ResourceName: corev1.ResourceCPU, RestartPolicy: tt.policy}}
+			old := newTestPod(app, newTestContainer("sidecar", "", "", "", "64Mi"))
+
+			in := old.DeepCopy()
+			in.Spec.Containers[0].Resources.Limits = newTestResources("", tt.resizedCPU, "", tt.resizedMemory).Limits
+
+			podGot, err := mutator.MutateResize(old, in)
+			require.NoError(t, err)
+
+			pathsGot := []string{}
+			for _, operation := range mutator.Operations() {
+				pathsGot = append(pathsGot, operation.Path)
+			}
+			assert.ElementsMatch(t, tt.operations, pathsGot)
+
+			resources := podGot.Spec.Containers[0].Resources
+			assert.Equal(t, tt.memoryRequest, resources.Requests.Memory().String())
+			assert.Equal(t, tt.cpuRequest, resources.Requests.Cpu().String())
+			assert.Equal(t, tt.cpuLimit, resources.Limits.Cpu().String())
+
+			// containers that are not resized are left as they are.
+			assert.Equal(t, in.Spec.Containers[1].Resources, podGot.Spec.Containers[1].Resources)
+			assert.Empty(t, podGot.Annotations)
+		})
+	}
+}
+
+// applyResize applies the operations of a resize the way the API server does
+// for the resize subresource, which only keeps the resources and resize
+// policies of the containers of the patched pod.
+func applyResize(t *testing.T, old, in *corev1.Pod, operations []jsonpatch.Operation) *corev1.Pod {
+	raw, err := json.Marshal(in)
+	require.NoError(t, err)
+	patch, err := Patch(operations)
+	require.NoError(t, err)
+	decoded, err := evanjsonpatch.DecodePatch(patch)
+	require.NoError(t, err)
+	patched, err := decoded.Apply(raw)
+	require.NoError(t, err)
+
+	pod := &corev1.Pod{}
+	require.NoError(t, json.Unmarshal(patched, pod))
+
+	out := old.DeepCopy()
+	for i := range out.Spec.InitContainers {
+		out.Spec.InitContainers[i].Resources = pod.Spec.InitContainers[i].Resources
+		out.Spec.InitContainers[i].ResizePolicy = pod.Spec.InitContainers[i].ResizePolicy
+	}
+	for i := range out.Spec.Containers {
+		out.Spec.Containers[i].Resources = pod.Spec.Containers[i].Resources
+		out.Spec.Containers[i].ResizePolicy = pod.Spec.Containers[i].ResizePolicy
+	}
+	return out
+}
+
+func TestMutateResizeOriginalCPURequest(t *testing.T) {
+	config := &Config{
+		MemoryRequestToLimitRatio: 0.5,
+		CpuRequestToRequestRatio:  0.5,
+	}
+
+	pod := newTestPod(newTestContainer("app", "1000m", "", "", "1Gi"))
+	pod.Spec.InitContainers = []corev1.Container{newTestSidecar(newTestContainer("proxy", "1000m", "", "", "1Gi"))}
+
+	// resize returns the pod the API server stores for the resize of old
+	// into a copy changed by update, and the operations of the resize.
+	resize := func(t *testing.T, old *corev1.Pod, update func(resources *corev1.ResourceRequirements)) (*corev1.Pod, *corev1.Pod, []jsonpatch.Operation) {
+		in := old.DeepCopy()
+		update(&in.Spec.InitContainers[0].Resources)
+		update(&in.Spec.Containers[0].Resources)
+
+		mutator, err := NewMutator(config, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+		require.NoError(t, err)
+		_, err = mutator.MutateResize(old, in)
+		require.NoError(t, err)
+
+		return in, applyResize(t, old, in, mutator.Operations()), mutator.Operations()
+	}
+
+	assertResources := func(t *testing.T, pod *corev1.Pod, cpuRequest, memoryRequest string) {
+		for _, container := range []corev1.Container{pod.Spec.InitContainers[0], pod.Spec.Containers[0]} {
+			assert.Equal(t, cpuRequest, container.Resources.Requests.Cpu().String(), container.Name)
+			assert.Equal(t, memoryRequest, container.Resources.Requests.Memory().String(), container.Name)
+		}
+
+		// the annotations keep the CPU requests the containers were created with.
+		assert.Equal(t, "1", pod.Annotations[OriginalCPURequestAnnotation+"-proxy"])
+		assert.Equal(t, "1", pod.Annotations[OriginalCPURequestAnnotation+"-app"])
+	}
+
+	mutator, err := NewMutator(config, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+	require.NoError(t, err)
+	created, err := mutator.Mutate(pod)
+	require.NoError(t, err)
+	assertResources(t, created, "500m", "512Mi")
+
+	// the CPU request the resize sets is kept.
+	in, resized, operations := resize(t, created, func(resources *corev1.ResourceRequirements) {
+		resources.Requests[corev1.ResourceCPU] = resource.MustParse("2000m")
+	})
+	assertResources(t, resized, "2", "512Mi")
+	assert.Empty(t, operations)
+
+	t.Run("WithReinvocation", func(t *testing.T) {
+		mutator, err := NewMutator(config, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+		require.NoError(t, err)
+		reinvoked, err := mutator.MutateResize(created, applyResize(t, in, in, operations))
+		require.NoError(t, err)
+
+		assertResources(t, reinvoked, "2", "512Mi")
+		assert.Empty(t, mutator.Operations())
+	})
+
+	t.Run("WithMemoryResizedAfterCPU", func(t *testing.T) {
+		_, podGot, operations := resize(t, resized, func(resources *corev1.ResourceRequirements) {
+			resources.Limits[corev1.ResourceMemory] = resource.MustParse("2Gi")
+		})
+
+		assertResources(t, podGot, "2", "1Gi")
+		for _, operation := range operations {
+			assert.NotContains(t, operation.Path, "/metadata")
+		}
+	})
+}
+
+func TestAdmitResize(t *testing.T) {
+	pod := newTestPod(newTestContainer("app", "250m", "2", "512Mi", "1Gi"))
+	old, err := json.Marshal(pod)
+	require.NoError(t, err)
+	pod.Spec.Containers[0].Resources.Limits[corev1.ResourceMemory] = resource.MustParse("2Gi")
+	in, err := json.Marshal(pod)
+	require.NoError(t, err)
+
+	querier, _ := newTestLimitQuerier(t, nil)
+	admission := &clusterResourceOverrideAdmission{
+		config: &Config{
+			LimitCPUToMemoryRatio:     2,
+			CpuRequestToLimitRatio:    0.25,
+			MemoryRequestToLimitRatio: 0.5,
+		},
+		limitQuerier: querier,
+	}
+
+	request := &admissionv1.AdmissionRequest{
+		Namespace:   "foo",
+		Operation:   admissionv1.Update,
+		Resource:    metav1.GroupVersionResource{Resource: string(corev1.ResourcePods)},
+		SubResource: ResizeSubResource,
+		Object:      runtime.RawExtension{Raw: in},
+		OldObject:   runtime.RawExtension{Raw: old},
+	}
+
+	response := admission.Admit(context.TODO(), request)
+	require.True(t, response.Allowed)
+	assert.Contains(t, string(response.Patch), "/spec/containers/0/resources")
+	assert.NotContains(t, string(response.Patch), "/metadata")
+
+	request.OldObject = runtime.RawExtension{Raw: []byte("{")}
+	response = admission.Admit(context.TODO(), request)
+	assert.False(t, response.Allowed)
+}
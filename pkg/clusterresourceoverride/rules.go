@@ -0,0 +1,260 @@
+package clusterresourceoverride
+
+import (
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// RuleConfig holds the settings of the pods a rule matches.
+type RuleConfig struct {
+	Name  string
+	Match RuleMatch
+	ClassConfig
+
+	// CPURequestToLimitPercentExpression and
+	// MemoryRequestToLimitPercentExpression compute the percents applied to
+	// each container.
+	CPURequestToLimitPercentExpression    string
+	MemoryRequestToLimitPercentExpression string
+
+	// expressions are compiled by ConvertExternalConfig, expressionsErr is
+	// why they failed to compile.
+	expressions    *ruleExpressions
+	expressionsErr error
+}
+
+func (r RuleConfig) String() string {
+	return fmt.Sprintf("%s:{%s}", r.Name, r.ClassConfig)
+}
+
+// RuleInput holds what rules match pods on that is not read from the pod
+// itself.
+type RuleInput struct {
+	// Priority is the priority value of the pod.
+	Priority int32
+
+	// OwnerKinds are the kinds of the controller of the pod and, if known,
+	// of the controller of that controller.
+	OwnerKinds []string
+
+	// Namespace is the namespace of the pod, which expressions read. It is
+	// only set if a rule has expressions.
+	Namespace *corev1.Namespace
+}
+
+// ForPod returns the configuration applied to the given pod, merged with the
+// first rule that matches it. A nil input matches no priority range nor owner
+// kind. An error is returned if the expressions of a rule can not be
+// evaluated.
+func (c *Config) ForPod(pod *corev1.Pod, input *RuleInput) (*Config, error) {
+	if input == nil {
+		input = &RuleInput{}
+	}
+
+	var expressionInput *expressionInput
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if !rule.Match.matches(pod, input) {
+			continue
+		}
+
+		if rule.hasExpressions() && rule.expressions == nil {
+			if rule.expressionsErr != nil {
+				return nil, fmt.Errorf("rules[%s].%s", rule.Name, rule.expressionsErr.Error())
+			}
+			return nil, fmt.Errorf("the expressions of rule %s are not compiled", rule.Name)
+		}
+
+		if rule.expressions != nil && rule.expressions.match != nil {
+			if expressionInput == nil {
+				expressionInput = newExpressionInput(pod, input.Namespace)
+			}
+
+			matched, err := rule.expressions.matches(expressionInput)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s %s", rule.Name, err.Error())
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		config, skip := rule.apply(c)
+		merged := *config
+		merged.Rule = rule.Name
+		merged.SkipResources = skip
+		merged.expressions = rule.expressions
+		merged.ruleOverride = &rule.ClassConfig
+		return &merged, nil
+	}
+
+	return c, nil
+}
+
+// hasExpressions returns true if any rule has expressions, which read the
+// namespace of pods.
+func (c *Config) hasExpressions() bool {
+	for i := range c.Rules {
+		if c.Rules[i].hasExpressions() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesPriority returns true if any rule matches pods on their priority
+// value, which then needs to be resolved.
+func (c *Config) matchesPriority() bool {
+	for i := range c.Rules {
+		if c.Rules[i].Match.Priority != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesOwnerKind returns true if any rule matches pods on one of the given
+// owner kinds.
+func (c *Config) matchesOwnerKind(kinds ...string) bool {
+	for i := range c.Rules {
+		for _, kind := range kinds {
+			if slices.Contains(c.Rules[i].Match.OwnerKinds, kind) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (m *RuleMatch) validate(prefix string) error {
+	if m.NodeLabel == nil && m.TolerationKey == "" && len(m.PriorityClassNames) == 0 && m.Priority == nil && len(m.OwnerKinds) == 0 && m.Expression == "" {
+		return fmt.Errorf("%s must set a criterion", prefix)
+	}
+
+	if m.NodeLabel != nil && m.NodeLabel.Key == "" {
+		return fmt.Errorf("%s.nodeLabel.key must be set", prefix)
+	}
+
+	if slices.Contains(m.PriorityClassNames, "") {
+		return fmt.Errorf("%s.priorityClassNames must not be empty", prefix)
+	}
+
+	if m.Priority != nil {
+		if m.Priority.Min == nil && m.Priority.Max == nil {
+			return fmt.Errorf("%s.priority must set min or max", prefix)
+		}
+		if m.Priority.Min != nil && m.Priority.Max != nil && *m.Priority.Min > *m.Priority.Max {
+			return fmt.Errorf("%s.priority.min=%d must not be greater than max=%d", prefix, *m.Priority.Min, *m.Priority.Max)
+		}
+	}
+
+	if slices.Contains(m.OwnerKinds, "") {
+		return fmt.Errorf("%s.ownerKinds must not be empty", prefix)
+	}
+
+	return nil
+}
+
+// matches returns true if the pod meets every criterion that is set, but the
+// expression, which ForPod evaluates last since it is the most expensive.
+func (m *RuleMatch) matches(pod *corev1.Pod, input *RuleInput) bool {
+	if m.NodeLabel != nil && !targetsNodeLabel(pod, m.NodeLabel) {
+		return false
+	}
+
+	if m.TolerationKey != "" && !toleratesKey(pod, m.TolerationKey) {
+		return false
+	}
+
+	if len(m.PriorityClassNames) > 0 && !slices.Contains(m.PriorityClassNames, pod.Spec.PriorityClassName) {
+		return false
+	}
+
+	if m.Priority != nil && !m.Priority.contains(input.Priority) {
+		return false
+	}
+
+	if len(m.OwnerKinds) > 0 && !slices.ContainsFunc(input.OwnerKinds, func(kind string) bool { return slices.Contains(m.OwnerKinds, kind) }) {
+		return false
+	}
+
+	return true
+}
+
+func (r *PriorityRange) contains(priority int32) bool {
+	return (r.Min == nil || priority >= *r.Min) && (r.Max == nil || priority <= *r.Max)
+}
+
+// targetsNodeLabel returns true if the pod can only be scheduled to nodes with
+// the label: its nodeSelector requires the label, or each of the terms of its
+// required node affinity does.
+func targetsNodeLabel(pod *corev1.Pod, label *NodeLabel) bool {
+	if value, found := pod.Spec.NodeSelector[label.Key]; found && (label.Value == "" || value == label.Value) {
+		return true
+	}
+
+	affinity := pod.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return false
+	}
+
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) == 0 {
+		return false
+	}
+
+	for i := range terms {
+		if !requiresNodeLabel(terms[i].MatchExpressions, label) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func requiresNodeLabel(requirements []corev1.NodeSelectorRequirement, label *NodeLabel) bool {
+	for _, requirement := range requirements {
+		if requirement.Key != label.Key {
+			continue
+		}
+
+		switch requirement.Operator {
+		case corev1.NodeSelectorOpExists:
+			if label.Value == "" {
+				return true
+			}
+		case corev1.NodeSelectorOpIn:
+			if len(requirement.Values) > 0 && (label.Value == "" || allEqual(requirement.Values, label.Value)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func allEqual(values []string, value string) bool {
+	for _, v := range values {
+		if v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// toleratesKey returns true if the pod tolerates taints with the given key.
+func toleratesKey(pod *corev1.Pod, key string) bool {
+	for i := range pod.Spec.Tolerations {
+		if pod.Spec.Tolerations[i].Key == key {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,280 @@
+package clusterresourceoverride
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func int32Ptr(value int32) *int32 {
+	return &value
+}
+
+func newRuleTestAffinity(terms ...corev1.NodeSelectorRequirement) *corev1.Affinity {
+	selector := &corev1.NodeSelector{}
+	for _, term := range terms {
+		selector.NodeSelectorTerms = append(selector.NodeSelectorTerms, corev1.NodeSelectorTerm{
+			MatchExpressions: []corev1.NodeSelectorRequirement{term},
+		})
+	}
+
+	return &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: selector}}
+}
+
+func TestRuleMatch(t *testing.T) {
+	spot := RuleMatch{NodeLabel: &NodeLabel{Key: "node-role.kubernetes.io/spot"}}
+	memory := RuleMatch{NodeLabel: &NodeLabel{Key: "pool", Value: "memory"}}
+	exists := func(key string) corev1.NodeSelectorRequirement {
+		return corev1.NodeSelectorRequirement{Key: key, Operator: corev1.NodeSelectorOpExists}
+	}
+	in := func(key string, values ...string) corev1.NodeSelectorRequirement {
+		return corev1.NodeSelectorRequirement{Key: key, Operator: corev1.NodeSelectorOpIn, Values: values}
+	}
+
+	tests := []struct {
+		name  string
+		match RuleMatch
+		spec  corev1.PodSpec
+		input RuleInput
+		want  bool
+	}{
+		{
+			name:  "WithNodeSelector",
+			match: spot,
+			spec:  corev1.PodSpec{NodeSelector: map[string]string{"node-role.kubernetes.io/spot": ""}},
+			want:  true,
+		},
+		{
+			name:  "WithNodeSelectorOfOtherValue",
+			match: memory,
+			spec:  corev1.PodSpec{NodeSelector: map[string]string{"pool": "general"}},
+		},
+		{
+			name:  "WithAffinityInEveryTerm",
+			match: spot,
+			spec:  corev1.PodSpec{Affinity: newRuleTestAffinity(exists("node-role.kubernetes.io/spot"), in("node-role.kubernetes.io/spot", "true"))},
+			want:  true,
+		},
+		{
+			name:  "WithAffinityInSomeTerms",
+			match: spot,
+			spec:  corev1.PodSpec{Affinity: newRuleTestAffinity(exists("node-role.kubernetes.io/spot"), exists("pool"))},
+		},
+		{
+			name:  "WithAffinityOfValue",
+			match: memory,
+			spec:  corev1.PodSpec{Affinity: newRuleTestAffinity(in("pool", "memory"))},
+			want:  true,
+		},
+		{
+			name:  "WithAffinityOfSeveralValues",
+			match: memory,
+			spec:  corev1.PodSpec{Affinity: newRuleTestAffinity(in("pool", "memory", "general"))},
+		},
+		{
+			name:  "WithToleration",
+			match: RuleMatch{TolerationKey: "spot"},
+			spec:  corev1.PodSpec{Tolerations: []corev1.Toleration{{Key: "spot", Operator: corev1.TolerationOpExists}}},
+			want:  true,
+		},
+		{
+			name:  "WithoutEveryCriterion",
+			match: RuleMatch{NodeLabel: &NodeLabel{Key: "pool"}, TolerationKey: "spot"},
+			spec:  corev1.PodSpec{NodeSelector: map[string]string{"pool": "general"}},
+		},
+		{
+			name:  "WithPriorityClassName",
+			match: RuleMatch{PriorityClassNames: []string{"high", "critical"}},
+			spec:  corev1.PodSpec{PriorityClassName: "critical"},
+			want:  true,
+		},
+		{
+			name:  "WithOtherPriorityClassName",
+			match: RuleMatch{PriorityClassNames: []string{"high"}},
+		},
+		{
+			name:  "WithPriorityInRange",
+			match: RuleMatch{Priority: &PriorityRange{Min: int32Ptr(1000)}},
+			input: RuleInput{Priority: 1000},
+			want:  true,
+		},
+		{
+			name:  "WithPriorityOutOfRange",
+			match: RuleMatch{Priority: &PriorityRange{Min: int32Ptr(0), Max: int32Ptr(999)}},
+			input: RuleInput{Priority: 1000},
+		},
+		{
+			name:  "WithOwnerKind",
+			match: RuleMatch{OwnerKinds: []string{"Job"}},
+			input: RuleInput{OwnerKinds: []string{"Job", "CronJob"}},
+			want:  true,
+		},
+		{
+			name:  "WithOwnerKindOfParent",
+			match: RuleMatch{OwnerKinds: []string{"Deployment"}},
+			input: RuleInput{OwnerKinds: []string{"ReplicaSet", "Deployment"}},
+			want:  true,
+		},
+		{
+			name:  "WithoutOwner",
+			match: RuleMatch{OwnerKinds: []string{"StatefulSet"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.match.matches(&corev1.Pod{Spec: tt.spec}, &tt.input))
+		})
+	}
+}
+
+func TestConfigForPod(t *testing.T) {
+	percent := func(value int64) *int64 { return &value }
+	config := ConvertExternalConfig(&ClusterResourceOverride{Spec: ClusterResourceOverrideSpec{
+		MemoryRequestToLimitPercent: 50,
+		CPURequestToLimitPercent:    50,
+		Rules: []Rule{
+			{
+				Name:                   "spot",
+				Match:                  RuleMatch{TolerationKey: "spot"},
+				ContainerClassOverride: ContainerClassOverride{CPURequestToLimitPercent: percent(20)},
+			},
+			{
+				Name:                   "infra",
+				Match:                  RuleMatch{NodeLabel: &NodeLabel{Key: "node-role.kubernetes.io/infra"}},
+				ContainerClassOverride: ContainerClassOverride{Skip: true},
+			},
+		},
+	}})
+	require.NoError(t, config.Validate())
+
+	spot := &corev1.Pod{Spec: corev1.PodSpec{Tolerations: []corev1.Toleration{{Key: "spot"}}}}
+	configGot, err := config.ForPod(spot, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "spot", configGot.Rule)
+	assert.Equal(t, 0.2, configGot.CpuRequestToLimitRatio)
+	assert.Equal(t, 0.5, configGot.MemoryRequestToLimitRatio)
+	assert.Equal(t, config.Version, configGot.Version)
+	assert.Empty(t, config.Rule)
+
+	infra := &corev1.Pod{Spec: corev1.PodSpec{NodeSelector: map[string]string{"node-role.kubernetes.io/infra": ""}}}
+	configGot, err = config.ForPod(infra, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "infra", configGot.Rule)
+	assert.True(t, configGot.SkipResources)
+
+	configGot, err = config.ForPod(&corev1.Pod{}, nil)
+	require.NoError(t, err)
+	assert.Same(t, config, configGot)
+}
+
+func TestConfigForPodByWorkload(t *testing.T) {
+	percent := func(value int64) *int64 { return &value }
+	config := ConvertExternalConfig(&ClusterResourceOverride{Spec: ClusterResourceOverrideSpec{
+		MemoryRequestToLimitPercent: 50,
+		Rules: []Rule{
+			{
+				Name:                   "critical",
+				Match:                  RuleMatch{Priority: &PriorityRange{Min: int32Ptr(1000000)}},
+				ContainerClassOverride: ContainerClassOverride{Skip: true},
+			},
+			{
+				Name:                   "batch",
+				Match:                  RuleMatch{OwnerKinds: []string{"Job"}},
+				ContainerClassOverride: ContainerClassOverride{MemoryRequestToLimitPercent: percent(10)},
+			},
+			{
+				Name:                   "stateful",
+				Match:                  RuleMatch{OwnerKinds: []string{"StatefulSet"}},
+				ContainerClassOverride: ContainerClassOverride{MemoryRequestToLimitPercent: percent(90)},
+			},
+		},
+	}})
+	require.NoError(t, config.Validate())
+	assert.True(t, config.matchesPriority())
+	assert.False(t, config.matchesOwnerKind("Deployment", "CronJob"))
+
+	tests := []struct {
+		name      string
+		input     *RuleInput
+		wantRule  string
+		wantRatio float64
+	}{
+		{
+			name:      "WithCronJob",
+			input:     &RuleInput{OwnerKinds: []string{"Job", "CronJob"}},
+			wantRule:  "batch",
+			wantRatio: 0.1,
+		},
+		{
+			name:      "WithStatefulSet",
+			input:     &RuleInput{OwnerKinds: []string{"StatefulSet"}},
+			wantRule:  "stateful",
+			wantRatio: 0.9,
+		},
+		{
+			name:      "WithCriticalJob",
+			input:     &RuleInput{Priority: 2000000000, OwnerKinds: []string{"Job"}},
+			wantRule:  "critical",
+			wantRatio: 0.5,
+		},
+		{
+			name:      "WithDeployment",
+			input:     &RuleInput{OwnerKinds: []string{"ReplicaSet", "Deployment"}},
+			wantRatio: 0.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configGot, err := config.ForPod(&corev1.Pod{}, tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantRule, configGot.Rule)
+			assert.Equal(t, tt.wantRatio, configGot.MemoryRequestToLimitRatio)
+		})
+	}
+}
+
+func TestConfigForPodWithContainerClass(t *testing.T) {
+	percent := func(value int64) *int64 { return &value }
+	config := ConvertExternalConfig(&ClusterResourceOverride{Spec: ClusterResourceOverrideSpec{
+		MemoryRequestToLimitPercent: 50,
+		CPURequestToLimitPercent:    50,
+		ContainerClasses: &ContainerClasses{
+			Regular: &ContainerClassOverride{CPURequestToLimitPercent: percent(80), MemoryRequestToLimitPercent: percent(70)},
+		},
+		Rules: []Rule{
+			{
+				Name:                   "spot",
+				Match:                  RuleMatch{TolerationKey: "spot"},
+				ContainerClassOverride: ContainerClassOverride{CPURequestToLimitPercent: percent(20)},
+			},
+		},
+	}})
+	require.NoError(t, config.Validate())
+
+	spot := &corev1.Pod{Spec: corev1.PodSpec{Tolerations: []corev1.Toleration{{Key: "spot"}}}}
+	configGot, err := config.ForPod(spot, nil)
+	require.NoError(t, err)
+
+	classConfigGot, skip := configGot.ForClass(ContainerClassRegular)
+	require.False(t, skip)
+	assert.Equal(t, 0.2, classConfigGot.CpuRequestToLimitRatio, "the percent of the rule must take precedence")
+	assert.Equal(t, 0.7, classConfigGot.MemoryRequestToLimitRatio)
+
+	classConfigGot, skip = config.ForClass(ContainerClassRegular)
+	require.False(t, skip)
+	assert.Equal(t, 0.8, classConfigGot.CpuRequestToLimitRatio)
+}
+
+func TestMutateWithSkipRule(t *testing.T) {
+	mutator, err := NewMutator(&Config{MemoryRequestToLimitRatio: 0.5, Rule: "infra", SkipResources: true}, &CPUMemory{}, &CPUMemory{}, cpuBaseScaleFactor)
+	require.NoError(t, err)
+
+	podGot, err := mutator.Mutate(newTestPod(newTestContainer("app", "", "", "", "1Gi")))
+	require.NoError(t, err)
+	assert.Empty(t, podGot.Spec.Containers[0].Resources.Requests)
+	assert.Empty(t, mutator.Operations())
+}
@@ -0,0 +1,146 @@
+package clusterresourceoverride
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	BoundFloor   = "floor"
+	BoundCeiling = "ceiling"
+
+	// BoundPodFloor and BoundPodCeiling bound the effective requests and
+	// limits of the whole pod.
+	BoundPodFloor   = "podFloor"
+	BoundPodCeiling = "podCeiling"
+
+	// BoundQuota bounds the effective requests and limits of the pod to what
+	// is left of the quotas of the namespace.
+	BoundQuota = "quota"
+
+	// BoundNode bounds the effective requests and limits of the pod to the
+	// largest allocatable of the nodes it can be scheduled to.
+	BoundNode = "node"
+
+	FieldRequest = "request"
+	FieldLimit   = "limit"
+)
+
+// Clamp records an overridden value that was moved to a namespace floor or ceiling.
+type Clamp struct {
+	Resource corev1.ResourceName `json:"resource"`
+	Field    string              `json:"field"`
+	Bound    string              `json:"bound"`
+	From     string              `json:"from"`
+	To       string              `json:"to"`
+}
+
+// ContainerMutation records the resources of a container before and after the
+// overrides were applied, along with any clamps applied along the way.
+type ContainerMutation struct {
+	Name   string                      `json:"name"`
+	Before corev1.ResourceRequirements `json:"before"`
+	After  corev1.ResourceRequirements `json:"after"`
+	Clamps []Clamp                     `json:"clamps,omitempty"`
+}
+
+// MutationSummary describes what a podMutator did to a pod.
+type MutationSummary struct {
+	Containers []ContainerMutation `json:"containers"`
+
+	// Pod records the pod-level resources, if the pod has any.
+	Pod *ContainerMutation `json:"pod,omitempty"`
+
+	// OverheadHeavy is true if the settings of overhead-heavy pods applied.
+	OverheadHeavy bool `json:"overheadHeavy,omitempty"`
+
+	// QoSBefore and QoSAfter are the QoS classes of the pod before and after
+	// the overrides, QoSAction what was done to keep the class, if anything.
+	QoSBefore corev1.PodQOSClass `json:"qosBefore,omitempty"`
+	QoSAfter  corev1.PodQOSClass `json:"qosAfter,omitempty"`
+	QoSAction string             `json:"qosAction,omitempty"`
+
+	// EphemeralContainers lists the ephemeral containers added to the pod.
+	EphemeralContainers []string `json:"ephemeralContainers,omitempty"`
+}
+
+// Clamps returns all clamps applied across containers.
+func (s *MutationSummary) Clamps() []Clamp {
+	if s == nil {
+		return nil
+	}
+
+	clamps := []Clamp{}
+	for i := range s.Containers {
+		clamps = append(clamps, s.Containers[i].Clamps...)
+	}
+	if s.Pod != nil {
+		clamps = append(clamps, s.Pod.Clamps...)
+	}
+
+	return clamps
+}
+
+// QoSChange returns the change of the QoS class of the pod, such as
+// "Guaranteed->Burstable", or an empty string if the class did not change.
+func (s *MutationSummary) QoSChange() string {
+	if s == nil || s.QoSBefore == s.QoSAfter {
+		return ""
+	}
+
+	return fmt.Sprintf("%s->%s", s.QoSBefore, s.QoSAfter)
+}
+
+// container returns the mutation of the container with the given name, nil
+// if the container was not overridden.
+func (s *MutationSummary) container(name string) *ContainerMutation {
+	if s == nil {
+		return nil
+	}
+
+	for i := range s.Containers {
+		if s.Containers[i].Name == name {
+			return &s.Containers[i]
+		}
+	}
+
+	return nil
+}
+
+// RequestRatio returns the ratio of the overridden request of the given resource
+// to the request the container would have had otherwise, which is the original
+// request or, if no request was set, the original limit.
+func (c *ContainerMutation) RequestRatio(name corev1.ResourceName) (ratio float64, ok bool) {
+	before, found := c.Before.Requests[name]
+	if !found {
+		before, found = c.Before.Limits[name]
+	}
+	if !found || before.IsZero() {
+		return
+	}
+
+	after, found := c.After.Requests[name]
+	if !found {
+		return
+	}
+
+	ratio = after.AsApproximateFloat64() / before.AsApproximateFloat64()
+	ok = true
+	return
+}
+
+func (c *ContainerMutation) addClamp(name corev1.ResourceName, field, bound string, from, to *resource.Quantity) {
+	if c == nil {
+		return
+	}
+
+	c.Clamps = append(c.Clamps, Clamp{
+		Resource: name,
+		Field:    field,
+		Bound:    bound,
+		From:     from.String(),
+		To:       to.String(),
+	})
+}
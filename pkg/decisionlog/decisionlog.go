@@ -0,0 +1,118 @@
+package decisionlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+	"k8s.io/klog"
+)
+
+const (
+	// pathEnvName is the name of the environment variable that holds the path
+	// of the decision log file. "-" writes to stdout, the log is disabled if
+	// it is not set.
+	pathEnvName = "DECISION_LOG_PATH"
+
+	// maxSizeEnvName is the name of the environment variable that holds the
+	// size in megabytes at which the decision log file is rotated.
+	maxSizeEnvName = "DECISION_LOG_MAX_SIZE_MB"
+
+	// maxBackupsEnvName is the name of the environment variable that holds
+	// the number of rotated decision log files to retain.
+	maxBackupsEnvName = "DECISION_LOG_MAX_BACKUPS"
+
+	defaultMaxSizeMB  = 100
+	defaultMaxBackups = 5
+
+	stdout = "-"
+)
+
+// Logger writes records as JSON, one per line. A nil Logger discards records.
+type Logger struct {
+	lock   sync.Mutex
+	writer io.Writer
+}
+
+func New(writer io.Writer) *Logger {
+	return &Logger{
+		writer: writer,
+	}
+}
+
+// NewFromEnv returns a Logger configured from the environment, or nil if the
+// decision log is disabled. Files are rotated once they reach the configured size.
+func NewFromEnv(stopCh <-chan struct{}) (logger *Logger, err error) {
+	path := os.Getenv(pathEnvName)
+	if path == "" {
+		return
+	}
+
+	if path == stdout {
+		logger = New(os.Stdout)
+		return
+	}
+
+	maxSize, err := intFromEnv(maxSizeEnvName, defaultMaxSizeMB)
+	if err != nil {
+		return
+	}
+
+	maxBackups, err := intFromEnv(maxBackupsEnvName, defaultMaxBackups)
+	if err != nil {
+		return
+	}
+
+	file := &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+	}
+	go func() {
+		<-stopCh
+		if closeErr := file.Close(); closeErr != nil {
+			klog.Warningf("file=%s failed to close decision log - %v", path, closeErr)
+		}
+	}()
+
+	logger = New(file)
+	return
+}
+
+// Write writes the JSON encoding of record as a single line.
+func (l *Logger) Write(record interface{}) {
+	if l == nil {
+		return
+	}
+
+	bytes, err := json.Marshal(record)
+	if err != nil {
+		klog.Warningf("failed to encode decision log record - %v", err)
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, err := l.writer.Write(append(bytes, '\n')); err != nil {
+		klog.Warningf("failed to write decision log record - %v", err)
+	}
+}
+
+func intFromEnv(name string, defaultValue int) (value int, err error) {
+	str := os.Getenv(name)
+	if str == "" {
+		value = defaultValue
+		return
+	}
+
+	value, err = strconv.Atoi(str)
+	if err != nil || value <= 0 {
+		err = fmt.Errorf("env var %s=%q must be a positive integer", name, str)
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package decisionlog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger_Write(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	logger := New(buffer)
+
+	logger.Write(map[string]string{"uid": "1"})
+	logger.Write(map[string]string{"uid": "2"})
+
+	assert.Equal(t, "{\"uid\":\"1\"}\n{\"uid\":\"2\"}\n", buffer.String())
+}
+
+func TestLogger_WriteWithNilLogger(t *testing.T) {
+	var logger *Logger
+
+	assert.NotPanics(t, func() {
+		logger.Write(map[string]string{"uid": "1"})
+	})
+}
+
+func TestNewFromEnv(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		t.Setenv(pathEnvName, "")
+
+		logger, err := NewFromEnv(nil)
+		require.NoError(t, err)
+		assert.Nil(t, logger)
+	})
+
+	t.Run("WithFile", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "decisions.log")
+		t.Setenv(pathEnvName, path)
+
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+
+		logger, err := NewFromEnv(stopCh)
+		require.NoError(t, err)
+		require.NotNil(t, logger)
+
+		logger.Write(map[string]string{"uid": "1"})
+
+		bytes, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "{\"uid\":\"1\"}\n", string(bytes))
+	})
+
+	t.Run("WithInvalidMaxSize", func(t *testing.T) {
+		t.Setenv(pathEnvName, filepath.Join(t.TempDir(), "decisions.log"))
+		t.Setenv(maxSizeEnvName, "zero")
+
+		_, err := NewFromEnv(nil)
+		assert.Error(t, err)
+	})
+}
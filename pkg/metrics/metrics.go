@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog"
+)
+
+const (
+	namespace = "clusterresourceoverride"
+
+	// maxNamespacesEnvName is the name of the environment variable that limits
+	// how many distinct namespaces are used as label values.
+	maxNamespacesEnvName = "METRICS_MAX_NAMESPACES"
+	defaultMaxNamespaces = 100
+)
+
+// Outcomes of an admission request.
+const (
+	OutcomeNotApplicable = "not_applicable"
+	OutcomeExempt        = "exempt"
+	OutcomeMutated       = "mutated"
+	OutcomeUnchanged     = "unchanged"
+	OutcomeError         = "error"
+	OutcomeFailedOpen    = "failed_open"
+	OutcomeRejected      = "rejected"
+)
+
+// Reasons an admission request failed.
+const (
+	ReasonNotInitialized  = "not_initialized"
+	ReasonBadRequest      = "bad_request"
+	ReasonNamespaceLookup = "namespace_lookup"
+	ReasonLimitRange      = "limitrange"
+	ReasonMutation        = "mutation"
+	ReasonPatch           = "patch"
+
+	// ReasonEphemeralContainers is the reason of OutcomeRejected for ephemeral
+	// containers the pod has no room for.
+	ReasonEphemeralContainers = "ephemeral_containers"
+
+	// ReasonResourceQuota is the reason of OutcomeRejected for pods the
+	// overrides push over a quota of their namespace.
+	ReasonResourceQuota = "resource_quota"
+)
+
+// Results of a live lookup made on an informer cache miss.
+const (
+	LookupFound            = "found"
+	LookupNotFound         = "not_found"
+	LookupError            = "error"
+	LookupNegativeCacheHit = "negative_cache_hit"
+	LookupPositiveCacheHit = "positive_cache_hit"
+)
+
+var (
+	requests = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      namespace,
+			Name:           "admission_requests_total",
+			Help:           "Number of admission requests handled by the webhook, partitioned by outcome and error reason.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"namespace", "outcome", "reason"},
+	)
+
+	admitDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      namespace,
+			Name:           "admit_duration_seconds",
+			Help:           "Latency of admission requests handled by the webhook, partitioned by outcome.",
+			Buckets:        metrics.ExponentialBuckets(0.0001, 2, 16),
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"outcome"},
+	)
+
+	patchSize = metrics.NewHistogram(
+		&metrics.HistogramOpts{
+			Namespace:      namespace,
+			Name:           "patch_size_bytes",
+			Help:           "Size of the JSON patches returned by the webhook.",
+			Buckets:        metrics.ExponentialBuckets(64, 2, 12),
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+
+	clamps = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      namespace,
+			Name:           "clamps_total",
+			Help:           "Number of overridden values moved to a LimitRange floor or ceiling, partitioned by resource.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"namespace", "resource", "field", "bound"},
+	)
+
+	requestRatio = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      namespace,
+			Name:           "request_ratio",
+			Help:           "Ratio of the overridden container request to the request the container would have had otherwise, partitioned by namespace and resource.",
+			Buckets:        metrics.LinearBuckets(0.1, 0.1, 10),
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"namespace", "resource"},
+	)
+
+	liveLookups = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      namespace,
+			Name:           "live_lookups_total",
+			Help:           "Number of lookups that fell back to the API server because the informer cache may be stale, partitioned by resource and result.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"resource", "result"},
+	)
+
+	registerOnce sync.Once
+	namespaces   = NewNamespaceLabeler(defaultMaxNamespaces)
+)
+
+// Register registers the webhook metrics with the legacy registry, which is
+// served on the /metrics endpoint of the admission server.
+func Register() {
+	registerOnce.Do(func() {
+		if value := os.Getenv(maxNamespacesEnvName); value != "" {
+			max, err := strconv.Atoi(value)
+			if err != nil || max < 0 {
+				klog.Warningf("env var %s=%q is not a valid non-negative integer, using default %d", maxNamespacesEnvName, value, defaultMaxNamespaces)
+			} else {
+				namespaces = NewNamespaceLabeler(max)
+			}
+		}
+
+		legacyregistry.MustRegister(requests, admitDuration, patchSize, clamps, requestRatio, liveLookups)
+	})
+}
+
+// RecordRequest counts an admission request with the given outcome. reason is
+// empty unless outcome is OutcomeError or OutcomeRejected.
+func RecordRequest(ns, outcome, reason string) {
+	requests.WithLabelValues(namespaces.Label(ns), outcome, reason).Inc()
+}
+
+// ObserveAdmitLatency records how long an admission request took.
+func ObserveAdmitLatency(outcome string, elapsed time.Duration) {
+	admitDuration.WithLabelValues(outcome).Observe(elapsed.Seconds())
+}
+
+// ObservePatchSize records the size of a patch returned to the API server.
+func ObservePatchSize(size int) {
+	patchSize.Observe(float64(size))
+}
+
+// RecordClamp counts an overridden value that was clamped to a bound.
+func RecordClamp(ns, resource, field, bound string) {
+	clamps.WithLabelValues(namespaces.Label(ns), resource, field, bound).Inc()
+}
+
+// ObserveRequestRatio records the ratio of an overridden request to the
+// request the container would have had otherwise.
+func ObserveRequestRatio(ns, resource string, ratio float64) {
+	requestRatio.WithLabelValues(namespaces.Label(ns), resource).Observe(ratio)
+}
+
+// RecordLiveLookup counts a lookup of the given resource that fell back to
+// the API server.
+func RecordLiveLookup(resource, result string) {
+	liveLookups.WithLabelValues(resource, result).Inc()
+}
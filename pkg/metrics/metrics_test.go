@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestObserveRequestRatio(t *testing.T) {
+	Register()
+
+	labeler := namespaces
+	namespaces = NewNamespaceLabeler(1)
+	t.Cleanup(func() {
+		namespaces = labeler
+	})
+
+	ObserveRequestRatio("foo", "memory", 0.5)
+	ObserveRequestRatio("bar", "memory", 0.25)
+	ObserveRequestRatio("baz", "memory", 0.75)
+
+	count, err := testutil.GetHistogramMetricCount(requestRatio.WithLabelValues("foo", "memory"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+
+	// namespaces beyond the limit are reported together.
+	count, err = testutil.GetHistogramMetricCount(requestRatio.WithLabelValues(OtherNamespace, "memory"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), count)
+}
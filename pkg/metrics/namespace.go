@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"sync"
+)
+
+// OtherNamespace is the label value used for namespaces beyond the configured limit.
+const OtherNamespace = "other"
+
+// NamespaceLabeler bounds the cardinality of the namespace label. The first
+// max distinct namespaces seen are used as label values as is, any other
+// namespace is reported as OtherNamespace. A max of zero drops the namespace
+// from the label altogether.
+type NamespaceLabeler struct {
+	lock sync.RWMutex
+	max  int
+	seen map[string]struct{}
+}
+
+func NewNamespaceLabeler(max int) *NamespaceLabeler {
+	return &NamespaceLabeler{
+		max:  max,
+		seen: map[string]struct{}{},
+	}
+}
+
+// Label returns the label value to use for the given namespace.
+func (l *NamespaceLabeler) Label(namespace string) string {
+	if l.max == 0 {
+		return ""
+	}
+
+	l.lock.RLock()
+	_, found := l.seen[namespace]
+	l.lock.RUnlock()
+	if found {
+		return namespace
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, found := l.seen[namespace]; found {
+		return namespace
+	}
+
+	if len(l.seen) >= l.max {
+		return OtherNamespace
+	}
+
+	l.seen[namespace] = struct{}{}
+	return namespace
+}
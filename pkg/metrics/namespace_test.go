@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaceLabeler_Label(t *testing.T) {
+	t.Run("WithinLimit", func(t *testing.T) {
+		labeler := NewNamespaceLabeler(2)
+
+		assert.Equal(t, "foo", labeler.Label("foo"))
+		assert.Equal(t, "bar", labeler.Label("bar"))
+		assert.Equal(t, "foo", labeler.Label("foo"))
+	})
+
+	t.Run("BeyondLimit", func(t *testing.T) {
+		labeler := NewNamespaceLabeler(1)
+
+		assert.Equal(t, "foo", labeler.Label("foo"))
+		assert.Equal(t, OtherNamespace, labeler.Label("bar"))
+		assert.Equal(t, "foo", labeler.Label("foo"))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		labeler := NewNamespaceLabeler(0)
+
+		assert.Equal(t, "", labeler.Label("foo"))
+	})
+}
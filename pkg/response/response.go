@@ -1,6 +1,7 @@
 package response
 
 import (
+	"encoding/json"
 	"net/http"
 
 	admissionv1 "k8s.io/api/admission/v1"
@@ -68,3 +69,32 @@ func WithPatch(request *admissionv1.AdmissionRequest, patch []byte) *admissionv1
 
 	return response
 }
+
+// WithAuditAnnotation adds a single audit annotation to the given response.
+// The API server prefixes the key with the name of the webhook when it writes
+// the audit event, so key should be a plain name such as "mutations".
+func WithAuditAnnotation(response *admissionv1.AdmissionResponse, key, value string) *admissionv1.AdmissionResponse {
+	if response.AuditAnnotations == nil {
+		response.AuditAnnotations = map[string]string{}
+	}
+
+	response.AuditAnnotations[key] = value
+	return response
+}
+
+// WithAuditAnnotationJSON adds an audit annotation whose value is the JSON
+// encoding of value. The annotation is omitted if value can not be encoded.
+func WithAuditAnnotationJSON(response *admissionv1.AdmissionResponse, key string, value interface{}) *admissionv1.AdmissionResponse {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return response
+	}
+
+	return WithAuditAnnotation(response, key, string(bytes))
+}
+
+// WithWarning adds a warning that the API server returns to the client.
+func WithWarning(response *admissionv1.AdmissionResponse, warning string) *admissionv1.AdmissionResponse {
+	response.Warnings = append(response.Warnings, warning)
+	return response
+}
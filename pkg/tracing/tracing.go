@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"k8s.io/component-base/tracing"
+	tracingapi "k8s.io/component-base/tracing/api/v1"
+	"k8s.io/klog"
+)
+
+const (
+	// endpointEnvName is the name of the environment variable that holds the
+	// address of the OTLP gRPC collector, for example localhost:4317.
+	// Tracing is disabled if it is not set.
+	endpointEnvName = "TRACING_ENDPOINT"
+
+	// samplingRateEnvName is the name of the environment variable that holds
+	// the number of requests sampled per million.
+	samplingRateEnvName = "TRACING_SAMPLING_RATE_PER_MILLION"
+
+	defaultSamplingRatePerMillion = 1000000
+
+	serviceName         = "clusterresourceoverride"
+	instrumentationName = "github.com/openshift/cluster-resource-override-admission"
+)
+
+// Attributes set on admission spans.
+const (
+	NamespaceKey      = attribute.Key("k8s.namespace.name")
+	RequestUIDKey     = attribute.Key("admission.request.uid")
+	OutcomeKey        = attribute.Key("admission.outcome")
+	ContainerCountKey = attribute.Key("k8s.pod.container.count")
+)
+
+var (
+	tracer trace.Tracer = noop.NewTracerProvider().Tracer(instrumentationName)
+)
+
+// Setup configures the tracer used by Start from the environment. Spans are
+// exported to an OTLP collector until stopCh is closed. Without an endpoint
+// configured spans are not recorded at all.
+func Setup(stopCh <-chan struct{}) error {
+	config, err := configFromEnv()
+	if err != nil {
+		return err
+	}
+
+	if config == nil {
+		klog.V(1).Infof("env var %s is not set, tracing is disabled", endpointEnvName)
+		return nil
+	}
+
+	provider, err := tracing.NewProvider(context.Background(), config, nil,
+		[]resource.Option{resource.WithAttributes(semconv.ServiceNameKey.String(serviceName))})
+	if err != nil {
+		return fmt.Errorf("failed to create tracer provider - %s", err.Error())
+	}
+
+	go func() {
+		<-stopCh
+		if err := provider.Shutdown(context.Background()); err != nil {
+			klog.Warningf("failed to shut down tracer provider - %v", err)
+		}
+	}()
+
+	tracer = provider.Tracer(instrumentationName)
+	klog.V(1).Infof("tracing enabled endpoint=%s samplingRatePerMillion=%d", *config.Endpoint, *config.SamplingRatePerMillion)
+	return nil
+}
+
+// Start starts a span as a child of the span in ctx, if any.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+func configFromEnv() (config *tracingapi.TracingConfiguration, err error) {
+	endpoint := os.Getenv(endpointEnvName)
+	if endpoint == "" {
+		return
+	}
+
+	rate := int32(defaultSamplingRatePerMillion)
+	if value := os.Getenv(samplingRateEnvName); value != "" {
+		parsed, parseErr := strconv.ParseInt(value, 10, 32)
+		if parseErr != nil || parsed < 0 || parsed > 1000000 {
+			err = fmt.Errorf("env var %s=%q must be an integer between 0 and 1000000", samplingRateEnvName, value)
+			return
+		}
+
+		rate = int32(parsed)
+	}
+
+	config = &tracingapi.TracingConfiguration{
+		Endpoint:               &endpoint,
+		SamplingRatePerMillion: &rate,
+	}
+	return
+}
@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		t.Setenv(endpointEnvName, "")
+
+		config, err := configFromEnv()
+		require.NoError(t, err)
+		assert.Nil(t, config)
+	})
+
+	t.Run("WithDefaultSamplingRate", func(t *testing.T) {
+		t.Setenv(endpointEnvName, "localhost:4317")
+
+		config, err := configFromEnv()
+		require.NoError(t, err)
+		require.NotNil(t, config)
+		assert.Equal(t, "localhost:4317", *config.Endpoint)
+		assert.Equal(t, int32(1000000), *config.SamplingRatePerMillion)
+	})
+
+	t.Run("WithSamplingRate", func(t *testing.T) {
+		t.Setenv(endpointEnvName, "localhost:4317")
+		t.Setenv(samplingRateEnvName, "5000")
+
+		config, err := configFromEnv()
+		require.NoError(t, err)
+		require.NotNil(t, config)
+		assert.Equal(t, int32(5000), *config.SamplingRatePerMillion)
+	})
+
+	t.Run("WithInvalidSamplingRate", func(t *testing.T) {
+		t.Setenv(endpointEnvName, "localhost:4317")
+		t.Setenv(samplingRateEnvName, "2000000")
+
+		_, err := configFromEnv()
+		assert.Error(t, err)
+	})
+}